@@ -0,0 +1,250 @@
+// Command xray-sampling-simulator reports which sampling rule matches each request,
+// and the expected number of sampled requests per second.
+//
+// Usage:
+//
+//	xray-sampling-simulator -manifest sampling.json -requests requests.csv
+//	aws xray get-sampling-rules > rules.json
+//	xray-sampling-simulator -centralized rules.json -requests requests.ndjson -duration 60s
+//
+// The requests are read from a CSV file with a header row, or a NDJSON file.
+// The columns (or the keys) are host, method, path, service_name and service_type.
+// The requests are assumed to be received in the period specified by -duration.
+// The requests that the strategy never samples, e.g. direct IP access for the centralized rules, are reported as excluded.
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/shogo82148/aws-xray-yasdk-go/xray/sampling"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "xray-sampling-simulator:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("xray-sampling-simulator", flag.ContinueOnError)
+	manifestPath := flags.String("manifest", "", "the path to the local sampling rule manifest")
+	centralizedPath := flags.String("centralized", "", "the path to the output of `aws xray get-sampling-rules`")
+	requestsPath := flags.String("requests", "-", "the path to the requests, or - for stdin")
+	format := flags.String("format", "", "the format of the requests: csv or ndjson (default: detected from the extension)")
+	duration := flags.Duration("duration", time.Second, "the period in which the requests are received")
+	quiet := flags.Bool("quiet", false, "report only the summary of the rules")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *duration <= 0 {
+		return errors.New("-duration must be positive")
+	}
+
+	simulator, err := loadSimulator(*manifestPath, *centralizedPath)
+	if err != nil {
+		return err
+	}
+	requests, err := loadRequests(*requestsPath, *format, stdin)
+	if err != nil {
+		return err
+	}
+	return report(stdout, simulator, requests, *duration, *quiet)
+}
+
+func loadSimulator(manifestPath, centralizedPath string) (*sampling.Simulator, error) {
+	switch {
+	case manifestPath != "" && centralizedPath != "":
+		return nil, errors.New("-manifest and -centralized are mutually exclusive")
+	case manifestPath != "":
+		f, err := os.Open(manifestPath)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		manifest, err := sampling.DecodeManifest(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", manifestPath, err)
+		}
+		return sampling.NewManifestSimulator(manifest)
+	case centralizedPath != "":
+		f, err := os.Open(centralizedPath)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		simulator, err := sampling.DecodeCentralizedRules(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", centralizedPath, err)
+		}
+		return simulator, nil
+	default:
+		return nil, errors.New("either -manifest or -centralized is required")
+	}
+}
+
+// request is a line of the requests file.
+type request struct {
+	Host        string `json:"host"`
+	Method      string `json:"method"`
+	Path        string `json:"path"`
+	ServiceName string `json:"service_name"`
+	ServiceType string `json:"service_type"`
+}
+
+func (r *request) samplingRequest() *sampling.Request {
+	return &sampling.Request{
+		Host:        r.Host,
+		Method:      r.Method,
+		URL:         r.Path,
+		ServiceName: r.ServiceName,
+		ServiceType: r.ServiceType,
+	}
+}
+
+func loadRequests(path, format string, stdin io.Reader) ([]*request, error) {
+	r := stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".csv":
+			format = "csv"
+		case ".ndjson", ".jsonl":
+			format = "ndjson"
+		default:
+			return nil, errors.New("-format is required to read the requests")
+		}
+	}
+
+	switch format {
+	case "csv":
+		return readCSV(r)
+	case "ndjson":
+		return readNDJSON(r)
+	default:
+		return nil, fmt.Errorf("unknown format: %s", format)
+	}
+}
+
+func readCSV(r io.Reader) ([]*request, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(strings.ToLower(name))] = i
+	}
+	get := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var requests []*request
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, &request{
+			Host:        get(record, "host"),
+			Method:      get(record, "method"),
+			Path:        get(record, "path"),
+			ServiceName: get(record, "service_name"),
+			ServiceType: get(record, "service_type"),
+		})
+	}
+	return requests, nil
+}
+
+func readNDJSON(r io.Reader) ([]*request, error) {
+	var requests []*request
+	scanner := bufio.NewScanner(r)
+	var line int
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var req request
+		if err := json.Unmarshal([]byte(text), &req); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		requests = append(requests, &req)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
+
+func report(w io.Writer, simulator *sampling.Simulator, requests []*request, duration time.Duration, quiet bool) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	counts := make(map[*sampling.SimulatedRule]int)
+	var excluded int
+	if !quiet {
+		fmt.Fprintln(tw, "HOST\tMETHOD\tPATH\tSERVICE NAME\tSERVICE TYPE\tRULE")
+	}
+	for _, req := range requests {
+		sr := req.samplingRequest()
+		name := "(none)"
+		if reason := simulator.Excluded(sr); reason != "" {
+			name = "(excluded: " + reason + ")"
+			excluded++
+		} else if rule := simulator.Match(sr); rule != nil {
+			name = rule.Name
+			counts[rule]++
+		}
+		if !quiet {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", req.Host, req.Method, req.Path, req.ServiceName, req.ServiceType, name)
+		}
+	}
+	if !quiet {
+		fmt.Fprintln(tw)
+	}
+
+	seconds := duration.Seconds()
+	var totalRequests, totalSampled float64
+	fmt.Fprintln(tw, "RULE\tRESERVOIR\tRATE\tREQUESTS/SEC\tSAMPLED/SEC")
+	for _, rule := range simulator.Rules() {
+		rps := float64(counts[rule]) / seconds
+		sampled := rule.ExpectedSampled(rps)
+		totalRequests += rps
+		totalSampled += sampled
+		fmt.Fprintf(tw, "%s\t%d\t%g\t%.3f\t%.3f\n", rule.Name, rule.Reservoir, rule.Rate, rps, sampled)
+	}
+	if excluded > 0 {
+		rps := float64(excluded) / seconds
+		totalRequests += rps
+		fmt.Fprintf(tw, "(excluded)\t\t\t%.3f\t%.3f\n", rps, 0.0)
+	}
+	fmt.Fprintf(tw, "TOTAL\t\t\t%.3f\t%.3f\n", totalRequests, totalSampled)
+	return tw.Flush()
+}
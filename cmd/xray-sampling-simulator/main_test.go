@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testManifest = `{
+	"version": 2,
+	"rules": [
+		{"description": "health", "host": "*", "service_name": "*", "http_method": "GET", "url_path": "/health", "fixed_target": 0, "rate": 0}
+	],
+	"default": {"fixed_target": 1, "rate": 0.5}
+}`
+
+func TestRun_CSV(t *testing.T) {
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, "sampling.json")
+	if err := os.WriteFile(manifest, []byte(testManifest), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	requests := filepath.Join(dir, "requests.csv")
+	if err := os.WriteFile(requests, []byte("method,host,path\nGET,example.com,/health\nGET,example.com,/\nPOST,example.com,/\nGET,example.com,/users\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := run([]string{"-manifest", manifest, "-requests", requests}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	got := out.String()
+	for _, want := range []string{
+		"example.com  GET     /health                              health",
+		"health   0          0     1.000         0.000",
+		// 1 from the reservoir, and a half of the rest.
+		"default  1          0.5   3.000         2.000",
+		"TOTAL                     4.000         2.000",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("want %q in the output, got:\n%s", want, got)
+		}
+	}
+}
+
+func TestRun_NDJSON(t *testing.T) {
+	dir := t.TempDir()
+	rules := filepath.Join(dir, "rules.json")
+	if err := os.WriteFile(rules, []byte(`{"SamplingRuleRecords": [
+		{"SamplingRule": {"RuleName": "Default", "Priority": 10000, "FixedRate": 0.1, "ReservoirSize": 1, "Host": "*", "HTTPMethod": "*", "URLPath": "*", "ServiceName": "*", "ServiceType": "*", "ResourceARN": "*"}}
+	]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stdin := strings.NewReader(`{"host": "example.com", "method": "GET", "path": "/"}
+
+{"host": "example.com", "method": "GET", "path": "/"}
+`)
+
+	var out bytes.Buffer
+	if err := run([]string{"-centralized", rules, "-format", "ndjson", "-duration", "2s", "-quiet"}, stdin, &out); err != nil {
+		t.Fatal(err)
+	}
+	got := out.String()
+	if strings.Contains(got, "example.com") {
+		t.Errorf("want no requests in the quiet output, got:\n%s", got)
+	}
+	if want := "Default  1          0.1   1.000         1.000"; !strings.Contains(got, want) {
+		t.Errorf("want %q in the output, got:\n%s", want, got)
+	}
+}
+
+func TestRun_AWSCLI(t *testing.T) {
+	// the output of `aws xray get-sampling-rules` writes the timestamps as ISO 8601 strings.
+	rules := filepath.Join("testdata", "get-sampling-rules.json")
+	stdin := strings.NewReader("host,method,path\nexample.com,GET,/users/42\nexample.com,GET,/\n10.0.0.1:8080,GET,/users/42\n")
+
+	var out bytes.Buffer
+	if err := run([]string{"-centralized", rules, "-format", "csv"}, stdin, &out); err != nil {
+		t.Fatal(err)
+	}
+	got := out.String()
+	for _, want := range []string{
+		"example.com    GET     /users/42                              Users",
+		"10.0.0.1:8080  GET     /users/42                              (excluded: direct IP access)",
+		"Users       2          0.1   1.000         1.000",
+		"Default     1          0.05  1.000         1.000",
+		"(excluded)                   1.000         0.000",
+		"TOTAL                        3.000         2.000",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("want %q in the output, got:\n%s", want, got)
+		}
+	}
+}
+
+func TestRun_Errors(t *testing.T) {
+	tests := [][]string{
+		{},
+		{"-manifest", "a.json", "-centralized", "b.json"},
+		{"-manifest", filepath.Join(t.TempDir(), "not-found.json")},
+	}
+	for _, args := range tests {
+		var out bytes.Buffer
+		if err := run(args, strings.NewReader(""), &out); err == nil {
+			t.Errorf("%v: want error, got nil", args)
+		}
+	}
+}
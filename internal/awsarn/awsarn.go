@@ -0,0 +1,25 @@
+// Package awsarn builds ARNs (Amazon Resource Names) of AWS resources.
+package awsarn
+
+import "strings"
+
+// Partition returns the AWS partition of the region.
+func Partition(region string) string {
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		return "aws-cn"
+	case strings.HasPrefix(region, "us-gov-"):
+		return "aws-us-gov"
+	default:
+		return "aws"
+	}
+}
+
+// New returns the ARN of the resource.
+// It returns empty string if region, accountID or resource is empty.
+func New(service, region, accountID, resource string) string {
+	if region == "" || accountID == "" || resource == "" {
+		return ""
+	}
+	return "arn:" + Partition(region) + ":" + service + ":" + region + ":" + accountID + ":" + resource
+}
@@ -0,0 +1,21 @@
+package awsarn
+
+import "testing"
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		region string
+		want   string
+	}{
+		{"ap-northeast-1", "arn:aws:ec2:ap-northeast-1:445285296882:instance/i-009df055e1f06d17f"},
+		{"cn-north-1", "arn:aws-cn:ec2:cn-north-1:445285296882:instance/i-009df055e1f06d17f"},
+		{"us-gov-west-1", "arn:aws-us-gov:ec2:us-gov-west-1:445285296882:instance/i-009df055e1f06d17f"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		got := New("ec2", tt.region, "445285296882", "instance/i-009df055e1f06d17f")
+		if got != tt.want {
+			t.Errorf("want %q, got %q", tt.want, got)
+		}
+	}
+}
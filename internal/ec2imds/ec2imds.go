@@ -0,0 +1,200 @@
+// Package ec2imds fetches the metadata of the EC2 instance from the instance metadata service (IMDS).
+// It is shared by the plugins that run on EC2 instances.
+package ec2imds
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/shogo82148/aws-xray-yasdk-go/internal/awsarn"
+	"github.com/shogo82148/aws-xray-yasdk-go/internal/envconfig"
+	"github.com/shogo82148/aws-xray-yasdk-go/xray/xraylog"
+	"github.com/shogo82148/go-retry/v2"
+)
+
+// InstanceIdentityDocument is the identity document of the EC2 instance.
+type InstanceIdentityDocument struct {
+	MarketplaceProductCodes []string  `json:"marketplaceProductCodes"`
+	AvailabilityZone        string    `json:"availabilityZone"`
+	PrivateIP               string    `json:"privateIp"`
+	Version                 string    `json:"version"`
+	Region                  string    `json:"region"`
+	InstanceID              string    `json:"instanceId"`
+	BillingProducts         []string  `json:"billingProducts"`
+	InstanceType            string    `json:"instanceType"`
+	AccountID               string    `json:"accountId"`
+	PendingTime             time.Time `json:"pendingTime"`
+	ImageID                 string    `json:"imageId"`
+	KernelID                string    `json:"kernelId"`
+	RamdiskID               string    `json:"ramdiskId"`
+	Architecture            string    `json:"architecture"`
+}
+
+// Client fetches EC2 metadata.
+// It provides same feature as [ec2metadata] or [ec2imds] package.
+// We don't want to depend on the AWS SDK, so we implement it by ourselves.
+//
+// [ec2metadata]: https://pkg.go.dev/github.com/aws/aws-sdk-go/aws/ec2metadata
+// [ec2imds]: https://pkg.go.dev/github.com/aws/aws-sdk-go-v2/ec2imds
+type Client struct {
+	// base url for the instance metadata api
+	// typically it is http://169.254.169.254
+	base string
+
+	// api token for IMDSv2
+	token string
+
+	// TTL for token
+	ttl time.Time
+
+	timeout time.Duration
+	policy  *retry.Policy
+
+	httpClient *http.Client
+}
+
+// New returns a new Client.
+// It returns nil if IMDS is disabled by the environment values.
+func New(ctx context.Context) *Client {
+	disabled := os.Getenv("AWS_EC2_METADATA_DISABLED")
+	if strings.EqualFold(disabled, "true") {
+		xraylog.Debugf(ctx, "ec2imds: imds is disabled by the environment value")
+		return nil
+	}
+
+	base := os.Getenv("AWS_EC2_METADATA_SERVICE_ENDPOINT")
+	if base == "" {
+		mode := os.Getenv("AWS_EC2_METADATA_SERVICE_ENDPOINT_MODE")
+		switch {
+		case mode == "" || strings.EqualFold(mode, "IPv4"):
+			base = "http://169.254.169.254"
+		case strings.EqualFold(mode, "IPv6"):
+			base = "http://[fd00:ec2::254]"
+		default:
+			xraylog.Debugf(ctx, "ec2imds: unknown aws ec2 metadata service endpoint mode: %q", mode)
+			return nil
+		}
+	}
+	base = strings.TrimSuffix(base, "/")
+	timeout := envconfig.MetadataServiceTimeout()
+
+	c := &Client{
+		base:    base,
+		timeout: timeout,
+		policy: &retry.Policy{
+			MaxCount: envconfig.MetadataServiceNumAttempts(),
+		},
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				// ignore proxy configure from the environment values
+				Proxy: nil,
+
+				// metadata endpoint is in same network,
+				// so timeout can be shorter.
+				DialContext: (&net.Dialer{
+					Timeout:   timeout,
+					KeepAlive: timeout,
+					DualStack: true,
+				}).DialContext,
+				MaxIdleConns:          5,
+				IdleConnTimeout:       timeout,
+				TLSHandshakeTimeout:   timeout,
+				ExpectContinueTimeout: timeout,
+			},
+		},
+	}
+	return c
+}
+
+// Close releases the resources of the client.
+func (c *Client) Close() {
+	c.httpClient.CloseIdleConnections()
+}
+
+func (c *Client) refreshToken(ctx context.Context) error {
+	return c.policy.Do(ctx, func() error {
+		now := time.Now()
+		if c.token != "" && c.ttl.After(now) {
+			// no need to refresh
+			return nil
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.base+"/latest/api/token", nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("x-aws-ec2-metadata-token-ttl-seconds", "10")
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			// IMDSv2 may be disabled; fallback to IMDSv1.
+			return nil
+		}
+
+		token, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		c.token = string(token)
+		c.ttl = now.Add(5 * time.Second)
+		return nil
+	})
+}
+
+// GetInstanceIdentityDocument returns the identity document of the instance.
+func (c *Client) GetInstanceIdentityDocument(ctx context.Context) (*InstanceIdentityDocument, error) {
+	if err := c.refreshToken(ctx); err != nil {
+		return nil, err
+	}
+
+	return retry.DoValue(ctx, c.policy, func() (*InstanceIdentityDocument, error) {
+		ctx, cancel := context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.base+"/latest/dynamic/instance-identity/document", nil)
+		if err != nil {
+			return nil, err
+		}
+		if c.token != "" {
+			req.Header.Set("x-aws-ec2-metadata-token", c.token)
+		}
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		}
+
+		var doc InstanceIdentityDocument
+		dec := json.NewDecoder(resp.Body)
+		if err := dec.Decode(&doc); err != nil {
+			return nil, err
+		}
+		return &doc, nil
+	})
+}
+
+// ARN returns the ARN of the instance.
+func (doc *InstanceIdentityDocument) ARN() string {
+	if doc.InstanceID == "" {
+		return ""
+	}
+	return awsarn.New("ec2", doc.Region, doc.AccountID, "instance/"+doc.InstanceID)
+}
@@ -0,0 +1,193 @@
+package sigv4
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Provider provides AWS credentials.
+type Provider interface {
+	Retrieve(ctx context.Context) (Credentials, error)
+}
+
+// ProviderFunc is an adapter to allow the use of ordinary functions as Provider.
+type ProviderFunc func(ctx context.Context) (Credentials, error)
+
+// Retrieve implements Provider.
+func (f ProviderFunc) Retrieve(ctx context.Context) (Credentials, error) {
+	return f(ctx)
+}
+
+// ErrNoCredentials is returned when no credentials are found.
+var ErrNoCredentials = errors.New("sigv4: no credentials found")
+
+// EnvProvider returns the credentials from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
+func EnvProvider(ctx context.Context) (Credentials, error) {
+	id := os.Getenv("AWS_ACCESS_KEY_ID")
+	secret := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if id == "" || secret == "" {
+		return Credentials{}, ErrNoCredentials
+	}
+	return Credentials{
+		AccessKeyID:     id,
+		SecretAccessKey: secret,
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}, nil
+}
+
+// the address of the ECS container credential endpoint.
+const containerCredentialsHost = "169.254.170.2"
+
+// ContainerProvider returns the credentials from the container credential endpoint,
+// that is configured by AWS_CONTAINER_CREDENTIALS_RELATIVE_URI or AWS_CONTAINER_CREDENTIALS_FULL_URI.
+// The authorization token is read from AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE or AWS_CONTAINER_AUTHORIZATION_TOKEN.
+type ContainerProvider struct {
+	Client *http.Client
+}
+
+type containerCredentials struct {
+	AccessKeyID     string    `json:"AccessKeyId"`
+	SecretAccessKey string    `json:"SecretAccessKey"`
+	Token           string    `json:"Token"`
+	Expiration      time.Time `json:"Expiration"`
+}
+
+// Retrieve implements Provider.
+func (p *ContainerProvider) Retrieve(ctx context.Context) (Credentials, error) {
+	endpoint, err := containerCredentialsEndpoint()
+	if err != nil {
+		return Credentials{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return Credentials{}, err
+	}
+	token, err := containerAuthorizationToken()
+	if err != nil {
+		return Credentials{}, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Credentials{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return Credentials{}, fmt.Errorf("sigv4: unexpected status code from the container credential endpoint: %d", resp.StatusCode)
+	}
+
+	var creds containerCredentials
+	if err := json.NewDecoder(resp.Body).Decode(&creds); err != nil {
+		return Credentials{}, err
+	}
+	return Credentials{
+		AccessKeyID:     creds.AccessKeyID,
+		SecretAccessKey: creds.SecretAccessKey,
+		SessionToken:    creds.Token,
+		Expires:         creds.Expiration,
+	}, nil
+}
+
+func containerCredentialsEndpoint() (string, error) {
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); uri != "" {
+		return "http://" + containerCredentialsHost + uri, nil
+	}
+	uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if uri == "" {
+		return "", ErrNoCredentials
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "https" && !isAllowedContainerHost(u.Hostname()) {
+		return "", fmt.Errorf("sigv4: the container credential endpoint %q must be https or a loopback address", uri)
+	}
+	return uri, nil
+}
+
+func isAllowedContainerHost(host string) bool {
+	switch host {
+	case "localhost", containerCredentialsHost,
+		"169.254.170.23", "fd00:ec2::23": // EKS Pod Identity Agent
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func containerAuthorizationToken() (string, error) {
+	if path := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	return os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"), nil
+}
+
+// expiryWindow is the duration to refresh the credentials before they expire.
+const expiryWindow = 5 * time.Minute
+
+// DefaultProvider returns the credentials from the environment values or the container credential endpoint.
+// The credentials are cached until they are about to expire.
+type DefaultProvider struct {
+	Container *ContainerProvider
+
+	// returns current time.
+	nowFunc func() time.Time
+
+	mu    sync.Mutex
+	creds Credentials
+}
+
+// Retrieve implements Provider.
+func (p *DefaultProvider) Retrieve(ctx context.Context) (Credentials, error) {
+	if creds, err := EnvProvider(ctx); err == nil {
+		return creds, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	if p.creds.AccessKeyID != "" && (p.creds.Expires.IsZero() || now.Add(expiryWindow).Before(p.creds.Expires)) {
+		return p.creds, nil
+	}
+
+	container := p.Container
+	if container == nil {
+		container = &ContainerProvider{}
+	}
+	creds, err := container.Retrieve(ctx)
+	if err != nil {
+		return Credentials{}, err
+	}
+	p.creds = creds
+	return creds, nil
+}
+
+func (p *DefaultProvider) now() time.Time {
+	if p.nowFunc != nil {
+		return p.nowFunc()
+	}
+	return time.Now()
+}
@@ -0,0 +1,149 @@
+package sigv4
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func clearCredentialsEnv(t *testing.T) {
+	t.Helper()
+	for _, key := range []string{
+		"AWS_ACCESS_KEY_ID",
+		"AWS_SECRET_ACCESS_KEY",
+		"AWS_SESSION_TOKEN",
+		"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI",
+		"AWS_CONTAINER_CREDENTIALS_FULL_URI",
+		"AWS_CONTAINER_AUTHORIZATION_TOKEN",
+		"AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE",
+	} {
+		t.Setenv(key, "")
+	}
+}
+
+func TestEnvProvider(t *testing.T) {
+	clearCredentialsEnv(t)
+	if _, err := EnvProvider(context.Background()); err != ErrNoCredentials {
+		t.Errorf("want %v, got %v", ErrNoCredentials, err)
+	}
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "token")
+	got, err := EnvProvider(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Credentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDefaultProvider_Container(t *testing.T) {
+	clearCredentialsEnv(t)
+	expiration := time.Date(2015, time.August, 30, 13, 0, 0, 0, time.UTC)
+
+	var count int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		count++
+		if got := req.Header.Get("Authorization"); got != "token-from-file" {
+			t.Errorf("unexpected authorization: %q", got)
+		}
+		json.NewEncoder(w).Encode(containerCredentials{
+			AccessKeyID:     "AKIDEXAMPLE",
+			SecretAccessKey: "secret",
+			Token:           "session-token",
+			Expiration:      expiration,
+		})
+	}))
+	defer ts.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("token-from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", ts.URL+"/credentials")
+	t.Setenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE", tokenFile)
+
+	now := expiration.Add(-time.Hour)
+	p := &DefaultProvider{
+		nowFunc: func() time.Time { return now },
+	}
+	got, err := p.Retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Credentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "secret",
+		SessionToken:    "session-token",
+		Expires:         expiration,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	// the credentials are cached.
+	if _, err := p.Retrieve(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("want %d, got %d", 1, count)
+	}
+
+	// the credentials are about to expire.
+	now = expiration.Add(-time.Minute)
+	if _, err := p.Retrieve(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("want %d, got %d", 2, count)
+	}
+}
+
+func TestContainerCredentialsEndpoint(t *testing.T) {
+	tests := []struct {
+		relative string
+		full     string
+		want     string
+		wantErr  bool
+	}{
+		{relative: "/v2/credentials/foo", want: "http://169.254.170.2/v2/credentials/foo"},
+		{full: "http://127.0.0.1:8080/credentials", want: "http://127.0.0.1:8080/credentials"},
+		{full: "http://169.254.170.23/v1/credentials", want: "http://169.254.170.23/v1/credentials"},
+		{full: "https://example.com/credentials", want: "https://example.com/credentials"},
+		{full: "http://example.com/credentials", wantErr: true},
+		{wantErr: true},
+	}
+	for _, tt := range tests {
+		clearCredentialsEnv(t)
+		t.Setenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", tt.relative)
+		t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", tt.full)
+		got, err := containerCredentialsEndpoint()
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q, %q: want error, got nil", tt.relative, tt.full)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q, %q: unexpected error: %v", tt.relative, tt.full, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("want %q, got %q", tt.want, got)
+		}
+	}
+}
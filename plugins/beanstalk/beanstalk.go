@@ -1,6 +1,7 @@
 // Package beanstalk provides plugin for AWS Elastic Beanstalk.
 // The plugin collects the information of Elastic Beanstalk environment,
 // and record them.
+// The ARN of the EC2 instance that runs the environment is used for matching the sampling rules.
 //
 // To enable this plugin, please import the beanstalk/init package.
 //
@@ -20,6 +21,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/shogo82148/aws-xray-yasdk-go/internal/ec2imds"
 	"github.com/shogo82148/aws-xray-yasdk-go/xray"
 	"github.com/shogo82148/aws-xray-yasdk-go/xray/schema"
 	"github.com/shogo82148/aws-xray-yasdk-go/xray/xraylog"
@@ -29,6 +31,7 @@ const configPath = "/var/elasticbeanstalk/xray/environment.conf"
 
 type plugin struct {
 	ElasticBeanstalk *schema.ElasticBeanstalk
+	arn              string
 }
 
 var once sync.Once
@@ -63,9 +66,30 @@ func initBeanstalkPlugin() {
 	}
 	xray.AddPlugin(&plugin{
 		ElasticBeanstalk: &conf,
+		arn:              instanceARN(ctx),
 	})
 }
 
+// instanceARN returns the ARN of the EC2 instance.
+// The environment runs on EC2 instances, so the identity document is available.
+func instanceARN(ctx context.Context) string {
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	c := ec2imds.New(ctx)
+	if c == nil {
+		return ""
+	}
+	defer c.Close()
+
+	doc, err := c.GetInstanceIdentityDocument(ctx)
+	if err != nil {
+		xraylog.Debugf(ctx, "failed to get identity document: %v", err)
+		return ""
+	}
+	return doc.ARN()
+}
+
 // HandleSegment implements Plugin.
 func (p *plugin) HandleSegment(seg *xray.Segment, doc *schema.Segment) {
 	if doc.AWS == nil {
@@ -76,3 +100,6 @@ func (p *plugin) HandleSegment(seg *xray.Segment, doc *schema.Segment) {
 
 // Origin implements Plugin.
 func (*plugin) Origin() string { return schema.OriginElasticBeanstalk }
+
+// ResourceARN implements ResourceARNPlugin.
+func (p *plugin) ResourceARN() string { return p.arn }
@@ -89,6 +89,9 @@ func (p *plugin) HandleSegment(seg *xray.Segment, doc *schema.Segment) {
 // Origin implements Plugin.
 func (*plugin) Origin() string { return schema.OriginECSContainer }
 
+// ResourceARN implements ResourceARNPlugin.
+func (p *plugin) ResourceARN() string { return p.ECS.ContainerArn }
+
 // Reads the docker-generated cgroup file that lists the full (untruncated) docker container ID at the end of each line.
 // This method takes advantage of that fact by just reading the 64-character ID from the end of the first line.
 func containerID(cgroup string) string {
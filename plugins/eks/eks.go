@@ -1,6 +1,9 @@
 // Package eks provides a plugin for Amazon EKS (Amazon Elastic Kubernetes Service).
 // The plugin collects the information of EKS containers, and record them.
 // The container ID, the pod name, and the cluster name are available.
+// The ARN of the cluster is used for matching the sampling rules.
+// The region and the account ID of the cluster are read from the environment values of IAM roles for service accounts,
+// or the identity document of the EC2 instance.
 //
 // To enable this plugin, please import the eks/init package.
 //
@@ -23,9 +26,12 @@ import (
 	"net/http"
 	"os"
 	"runtime"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/shogo82148/aws-xray-yasdk-go/internal/awsarn"
+	"github.com/shogo82148/aws-xray-yasdk-go/internal/ec2imds"
 	"github.com/shogo82148/aws-xray-yasdk-go/xray"
 	"github.com/shogo82148/aws-xray-yasdk-go/xray/schema"
 	"github.com/shogo82148/aws-xray-yasdk-go/xray/xraylog"
@@ -40,6 +46,7 @@ const (
 type plugin struct {
 	EKS           *schema.EKS
 	logReferences []*schema.LogReference
+	arn           string
 }
 
 var once sync.Once
@@ -108,6 +115,7 @@ func initEKSPlugin() {
 				LogGroup: "/aws/containerinsights/" + clusterName + "/application",
 			},
 		},
+		arn: clusterARN(ctx, clusterName),
 	})
 }
 
@@ -123,6 +131,56 @@ func (p *plugin) HandleSegment(seg *xray.Segment, doc *schema.Segment) {
 // Origin implements Plugin.
 func (*plugin) Origin() string { return schema.OriginEKSContainer }
 
+// ResourceARN implements ResourceARNPlugin.
+func (p *plugin) ResourceARN() string { return p.arn }
+
+// clusterARN returns the ARN of the cluster.
+func clusterARN(ctx context.Context, clusterName string) string {
+	if clusterName == "" {
+		return ""
+	}
+	region, accountID := accountFromEnv()
+	if region == "" || accountID == "" {
+		region, accountID = accountFromIMDS(ctx)
+	}
+	return awsarn.New("eks", region, accountID, "cluster/"+clusterName)
+}
+
+// accountFromEnv returns the region and the account ID from the environment values,
+// that IAM roles for service accounts injects.
+func accountFromEnv() (region, accountID string) {
+	region = os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+
+	// arn:partition:iam::account-id:role/role-name
+	parts := strings.SplitN(os.Getenv("AWS_ROLE_ARN"), ":", 6)
+	if len(parts) == 6 {
+		accountID = parts[4]
+	}
+	return region, accountID
+}
+
+// accountFromIMDS returns the region and the account ID from the identity document of the node.
+func accountFromIMDS(ctx context.Context) (region, accountID string) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	c := ec2imds.New(ctx)
+	if c == nil {
+		return "", ""
+	}
+	defer c.Close()
+
+	doc, err := c.GetInstanceIdentityDocument(ctx)
+	if err != nil {
+		xraylog.Debugf(ctx, "failed to get identity document: %v", err)
+		return "", ""
+	}
+	return doc.Region, doc.AccountID
+}
+
 // Reads the docker-generated cgroup file that lists the full (untruncated) docker container ID at the end of each line.
 // This method takes advantage of that fact by just reading the 64-character ID from the end of the first line.
 func containerID(ctx context.Context, cgroup string) string {
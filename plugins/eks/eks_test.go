@@ -20,3 +20,19 @@ func TestContainerID(t *testing.T) {
 		t.Errorf("want %s, got %s", want, got)
 	}
 }
+
+func TestClusterARN(t *testing.T) {
+	t.Setenv("AWS_REGION", "ap-northeast-1")
+	t.Setenv("AWS_ROLE_ARN", "arn:aws:iam::445285296882:role/eks-pod-role")
+
+	got := clusterARN(context.Background(), "my-cluster")
+	want := "arn:aws:eks:ap-northeast-1:445285296882:cluster/my-cluster"
+	if got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+
+	// the cluster name is unknown.
+	if got := clusterARN(context.Background(), ""); got != "" {
+		t.Errorf("want empty, got %s", got)
+	}
+}
@@ -0,0 +1,16 @@
+// Package init installs the Lambda plugin at init time.
+// To enable this plugin, please import the lambda/init package.
+//
+//	import _ "github.com/shogo82148/aws-xray-yasdk-go/xray/plugins/lambda/init"
+//
+// or if you want to load conditionally at runtime, use Init() function.
+//
+//	import _ "github.com/shogo82148/aws-xray-yasdk-go/xray/plugins/lambda"
+//	lambda.Init()
+package init
+
+import "github.com/shogo82148/aws-xray-yasdk-go/plugins/lambda"
+
+func init() {
+	lambda.Init()
+}
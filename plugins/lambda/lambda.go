@@ -0,0 +1,130 @@
+// Package lambda provides a plugin for AWS Lambda.
+// The plugin detects the ARN of the function, and it is used for matching the sampling rules
+// of the segments that the function begins by itself, e.g. the segments for each message of SQS batches.
+// The segments of the invocations are recorded by Lambda, and Lambda applies the sampling rules to them.
+//
+// The account ID of the function isn't available in the environment values,
+// so the plugin calls the STS GetCallerIdentity API with the credentials of the function.
+//
+// To enable this plugin, please import the lambda/init package.
+//
+//	import _ "github.com/shogo82148/aws-xray-yasdk-go/xray/plugins/lambda/init"
+//
+// or if you want to load conditionally at runtime, use Init() function.
+//
+//	import _ "github.com/shogo82148/aws-xray-yasdk-go/xray/plugins/lambda"
+//	lambda.Init()
+package lambda
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shogo82148/aws-xray-yasdk-go/internal/awsarn"
+	"github.com/shogo82148/aws-xray-yasdk-go/internal/sigv4"
+	"github.com/shogo82148/aws-xray-yasdk-go/xray"
+	"github.com/shogo82148/aws-xray-yasdk-go/xray/schema"
+	"github.com/shogo82148/aws-xray-yasdk-go/xray/xraylog"
+)
+
+type plugin struct {
+	arn string
+}
+
+var once sync.Once
+
+// Init activates Lambda Plugin at runtime.
+func Init() {
+	once.Do(initLambdaPlugin)
+}
+
+func initLambdaPlugin() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	name := os.Getenv("AWS_LAMBDA_FUNCTION_NAME")
+	region := os.Getenv("AWS_REGION")
+	if name == "" || region == "" {
+		// it seems not to be in AWS Lambda environment.
+		xraylog.Debug(ctx, "plugin/lambda: AWS_LAMBDA_FUNCTION_NAME or AWS_REGION is not set")
+		return
+	}
+
+	endpoint := os.Getenv("AWS_ENDPOINT_URL_STS")
+	if endpoint == "" {
+		endpoint = stsEndpoint(region)
+	}
+	accountID, err := getAccountID(ctx, http.DefaultClient, endpoint, region)
+	if err != nil {
+		xraylog.Debugf(ctx, "plugin/lambda: failed to get the account id: %v", err)
+		return
+	}
+	xray.AddPlugin(&plugin{
+		arn: awsarn.New("lambda", region, accountID, "function:"+name),
+	})
+}
+
+// stsEndpoint returns the regional endpoint of STS.
+func stsEndpoint(region string) string {
+	if awsarn.Partition(region) == "aws-cn" {
+		return "https://sts." + region + ".amazonaws.com.cn"
+	}
+	return "https://sts." + region + ".amazonaws.com"
+}
+
+// getAccountID returns the account ID of the credentials.
+//
+// https://docs.aws.amazon.com/STS/latest/APIReference/API_GetCallerIdentity.html
+func getAccountID(ctx context.Context, client *http.Client, endpoint, region string) (string, error) {
+	creds, err := sigv4.EnvProvider(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	body := []byte("Action=GetCallerIdentity&Version=2011-06-15")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(endpoint, "/")+"/", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	sigv4.Sign(req, body, creds, "sts", region, time.Now())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var output struct {
+		Account string `xml:"GetCallerIdentityResult>Account"`
+	}
+	dec := xml.NewDecoder(resp.Body)
+	if err := dec.Decode(&output); err != nil {
+		return "", err
+	}
+	if output.Account == "" {
+		return "", fmt.Errorf("the account id is empty")
+	}
+	return output.Account, nil
+}
+
+// HandleSegment implements Plugin.
+func (p *plugin) HandleSegment(seg *xray.Segment, doc *schema.Segment) {}
+
+// Origin implements Plugin.
+// The segments that the function begins by itself are not the function itself,
+// so the plugin doesn't set the origin.
+func (*plugin) Origin() string { return "" }
+
+// ResourceARN implements ResourceARNPlugin.
+func (p *plugin) ResourceARN() string { return p.arn }
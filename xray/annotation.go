@@ -0,0 +1,195 @@
+package xray
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/shogo82148/aws-xray-yasdk-go/xray/xraylog"
+)
+
+// DefaultMaxAnnotationsPerTrace is the maximum number of annotations per trace that AWS X-Ray accepts.
+const DefaultMaxAnnotationsPerTrace = 50
+
+// AnnotationOverflowPolicy specifies how to handle annotations that exceed the limits.
+type AnnotationOverflowPolicy int
+
+const (
+	// AnnotationOverflowDrop drops the annotations that exceed the limits.
+	AnnotationOverflowDrop AnnotationOverflowPolicy = iota
+
+	// AnnotationOverflowMetadata records the annotations that exceed the limits
+	// as metadata in the "annotations" namespace.
+	// They are not indexed, but they are visible in the trace.
+	AnnotationOverflowMetadata
+)
+
+// annotationOverflowNamespace is the metadata namespace for AnnotationOverflowMetadata.
+const annotationOverflowNamespace = "annotations"
+
+// AnnotationValue is the constraint of the annotation values that AWS X-Ray supports.
+type AnnotationValue interface {
+	~bool | ~string |
+		~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64
+}
+
+// annotation key should match /\A[A-Za-z0-9_]+\z/
+func sanitizeAnnotationKey(key string) string {
+	var builder strings.Builder
+	builder.Grow(len(key))
+	for i := 0; i < len(key); i++ {
+		b := key[i]
+		if 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9' || b == '_' {
+			builder.WriteByte(b)
+		}
+		// ignore invalid characters
+	}
+	return builder.String()
+}
+
+// normalizeAnnotationValue converts value into bool, string, int64, uint64 or float64.
+// It returns false if value is not supported by AWS X-Ray.
+func normalizeAnnotationValue(value any) (any, bool) {
+	switch value := value.(type) {
+	case bool, string, int64, uint64, float64:
+		return value, true
+	case nil:
+		return nil, false
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool(), true
+	case reflect.String:
+		return v.String(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint(), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return nil, false
+}
+
+func (seg *Segment) addAnnotation(key string, value any) {
+	if seg == nil {
+		return
+	}
+	name := sanitizeAnnotationKey(key)
+	if name == "" {
+		xraylog.Warnf(seg.ctx, "xray: annotation key %q has no valid characters, ignored", key)
+		return
+	}
+	if name != key {
+		xraylog.Debugf(seg.ctx, "xray: annotation key %q is sanitized to %q", key, name)
+	}
+	config := seg.client().getConfig()
+
+	root := seg.root
+	root.mu.Lock()
+	defer root.mu.Unlock()
+	if seg != root {
+		seg.mu.Lock()
+		defer seg.mu.Unlock()
+	}
+
+	if _, ok := seg.annotations[name]; ok {
+		// overwriting an existing annotation doesn't change the number of annotations.
+		seg.annotations[name] = value
+		return
+	}
+
+	if config.maxAnnotationsPerSegment > 0 && len(seg.annotations) >= config.maxAnnotationsPerSegment ||
+		config.maxAnnotationsPerTrace > 0 && root.totalAnnotations >= config.maxAnnotationsPerTrace {
+		switch config.annotationOverflowPolicy {
+		case AnnotationOverflowMetadata:
+			xraylog.Debugf(seg.ctx, "xray: annotation %q exceeds the limits, recorded as metadata", name)
+			seg.addMetadataLocked(annotationOverflowNamespace, name, encodeMetadata(value, 0), config.maxMetadataBytesPerSegment)
+		default:
+			xraylog.Warnf(seg.ctx, "xray: annotation %q exceeds the limits, dropped", name)
+		}
+		return
+	}
+
+	if seg.annotations == nil {
+		seg.annotations = make(map[string]any)
+	}
+	seg.annotations[name] = value
+	root.totalAnnotations++
+}
+
+// AddAnnotations adds annotations.
+// The values should be bool, string, or numeric types.
+// The annotations with unsupported types are ignored.
+func (seg *Segment) AddAnnotations(annotations map[string]any) {
+	if seg == nil {
+		return
+	}
+	for key, value := range annotations {
+		v, ok := normalizeAnnotationValue(value)
+		if !ok {
+			xraylog.Warnf(seg.ctx, "xray: annotation %q has unsupported type %T, ignored", key, value)
+			continue
+		}
+		seg.addAnnotation(key, v)
+	}
+}
+
+// AddAnnotations adds annotations.
+// The values should be bool, string, or numeric types.
+// The annotations with unsupported types are ignored.
+func AddAnnotations(ctx context.Context, annotations map[string]any) {
+	ContextSegment(ctx).AddAnnotations(annotations)
+}
+
+// AddAnnotation adds an annotation.
+// Unlike [AddAnnotations], unsupported types are rejected at compile time.
+func AddAnnotation[T AnnotationValue](ctx context.Context, key string, value T) {
+	addAnnotationTyped(ContextSegment(ctx), key, value)
+}
+
+func addAnnotationTyped[T AnnotationValue](seg *Segment, key string, value T) {
+	if seg == nil {
+		return
+	}
+	v, ok := normalizeAnnotationValue(value)
+	if !ok {
+		// AnnotationValue guarantees that value is supported.
+		panic(fmt.Sprintf("xray: unexpected annotation type %T", value))
+	}
+	seg.addAnnotation(key, v)
+}
+
+// AnnotationKey is an annotation key that is bound to the type of its value.
+//
+//	var tenantKey = xray.NewAnnotationKey[string]("tenant")
+//	tenantKey.Add(ctx, "example")
+type AnnotationKey[T AnnotationValue] struct {
+	name string
+}
+
+// NewAnnotationKey returns a new AnnotationKey.
+// The name is sanitized in the same way as the annotations added by [AddAnnotation].
+func NewAnnotationKey[T AnnotationValue](name string) AnnotationKey[T] {
+	return AnnotationKey[T]{name: sanitizeAnnotationKey(name)}
+}
+
+// Name returns the sanitized name of the key.
+func (k AnnotationKey[T]) Name() string {
+	return k.name
+}
+
+// Add adds an annotation to the segment of the context.
+func (k AnnotationKey[T]) Add(ctx context.Context, value T) {
+	addAnnotationTyped(ContextSegment(ctx), k.name, value)
+}
+
+// AddToSegment adds an annotation to the segment.
+func (k AnnotationKey[T]) AddToSegment(seg *Segment, value T) {
+	addAnnotationTyped(seg, k.name, value)
+}
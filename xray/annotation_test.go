@@ -0,0 +1,163 @@
+package xray
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/shogo82148/aws-xray-yasdk-go/xray/sampling"
+	"github.com/shogo82148/aws-xray-yasdk-go/xray/schema"
+)
+
+func TestSanitizeAnnotationKey(t *testing.T) {
+	tc := []struct {
+		in   string
+		want string
+	}{
+		{in: "abc_123", want: "abc_123"},
+		{in: "ABC", want: "ABC"},
+		{in: "foo.bar-baz qux", want: "foobarbazqux"},
+		{in: "こんにちは", want: ""},
+	}
+	for _, tt := range tc {
+		got := sanitizeAnnotationKey(tt.in)
+		if got != tt.want {
+			t.Errorf("%q: want %q, got %q", tt.in, tt.want, got)
+		}
+	}
+}
+
+type myInt int
+
+type myString string
+
+func TestAddAnnotation(t *testing.T) {
+	nowFunc = fixedTime
+	defer func() { nowFunc = time.Now }()
+
+	ctx, td := NewTestDaemon(nil)
+	defer td.Close()
+
+	tenantKey := NewAnnotationKey[myString]("tenant-id")
+	if tenantKey.Name() != "tenantid" {
+		t.Errorf("want %q, got %q", "tenantid", tenantKey.Name())
+	}
+
+	ctx, seg := BeginSegment(ctx, "foobar")
+	AddAnnotation(ctx, "int", myInt(42))
+	AddAnnotation(ctx, "invalid.key", "value")
+	AddAnnotation(ctx, "!!!", "ignored")
+	tenantKey.Add(ctx, "example")
+	AddAnnotations(ctx, map[string]any{
+		"float32":     float32(0.5),
+		"unsupported": []string{"a", "b"},
+	})
+	seg.Close()
+
+	got, err := td.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &schema.Segment{
+		Name:      "foobar",
+		ID:        seg.id,
+		TraceID:   seg.traceID,
+		StartTime: 1000000000,
+		EndTime:   1000000000,
+		Annotations: map[string]any{
+			"int":        42.0,
+			"invalidkey": "value",
+			"tenantid":   "example",
+			"float32":    0.5,
+		},
+		Service: ServiceData,
+		AWS:     xrayData,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestAddAnnotation_Limits(t *testing.T) {
+	nowFunc = fixedTime
+	defer func() { nowFunc = time.Now }()
+
+	t.Run("drop", func(t *testing.T) {
+		ctx, td := NewTestDaemon(nil)
+		defer td.Close()
+		if err := ContextClient(ctx).Reconfigure(&Config{
+			DaemonAddress:            td.DaemonAddress(),
+			SamplingStrategy:         sampling.NewAllStrategy(),
+			MaxAnnotationsPerSegment: 2,
+			MaxAnnotationsPerTrace:   3,
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, seg := BeginSegment(ctx, "foobar")
+		for i := range 3 {
+			AddAnnotation(ctx, "root"+strconv.Itoa(i), i)
+		}
+		// overwriting doesn't count.
+		AddAnnotation(ctx, "root0", 100)
+		_, sub := BeginSubsegment(ctx, "sub")
+		for i := range 3 {
+			sub.AddAnnotationInt64("sub"+strconv.Itoa(i), int64(i))
+		}
+		sub.Close()
+		seg.Close()
+
+		got, err := td.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]any{
+			"root0": 100.0,
+			"root1": 1.0,
+		}
+		if diff := cmp.Diff(want, got.Annotations); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+		want = map[string]any{
+			"sub0": 0.0,
+		}
+		if diff := cmp.Diff(want, got.Subsegments[0].Annotations); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("metadata", func(t *testing.T) {
+		ctx, td := NewTestDaemon(nil)
+		defer td.Close()
+		if err := ContextClient(ctx).Reconfigure(&Config{
+			DaemonAddress:            td.DaemonAddress(),
+			SamplingStrategy:         sampling.NewAllStrategy(),
+			MaxAnnotationsPerTrace:   1,
+			AnnotationOverflowPolicy: AnnotationOverflowMetadata,
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, seg := BeginSegment(ctx, "foobar")
+		AddAnnotation(ctx, "first", "indexed")
+		AddAnnotation(ctx, "second", "not indexed")
+		seg.Close()
+
+		got, err := td.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(map[string]any{"first": "indexed"}, got.Annotations); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+		wantMetadata := map[string]any{
+			"annotations": map[string]any{
+				"second": "not indexed",
+			},
+		}
+		if diff := cmp.Diff(wantMetadata, got.Metadata); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net"
 	"os"
 	"sync"
@@ -17,18 +19,34 @@ import (
 
 const emitTimeout = 100 * time.Millisecond
 
+// ErrClientClosed is returned by the methods of [Client] after the client is closed.
+var ErrClientClosed = errors.New("xray: client is closed")
+
 var header = []byte(`{"format":"json","version":1}` + "\n")
 var dialer = net.Dialer{
 	Timeout: emitTimeout,
 }
 
-var defaultClient = New(nil)
+var defaultClient = newDefaultClient()
+
+// newDefaultClient returns the default client.
+// It is created at the package initialization, so the invalid AWS_XRAY_SAMPLING_RULES must not panic.
+// The error is logged, and the centralized sampling strategy is used instead.
+func newDefaultClient() *Client {
+	cfg, err := buildClientConfig(nil, true)
+	if err != nil {
+		panic(err)
+	}
+	return newClient(cfg)
+}
 
-// Configure replaces the default client with the cfg.
+// Configure reconfigures the default client with the cfg.
+// If the default client is closed, it is reopened with the cfg.
+// The error of the configure is logged, and the default client keeps the current configure.
 func Configure(cfg *Config) {
-	client := New(cfg)
-	defaultClient.Close()
-	defaultClient = client
+	if err := defaultClient.reconfigure(cfg, true); err != nil {
+		xraylog.Errorf(context.Background(), "xray: failed to configure: %v", err)
+	}
 }
 
 // ContextClient returns the client of current context.
@@ -46,36 +64,108 @@ func WithClient(ctx context.Context, client *Client) context.Context {
 
 // Client is a client for AWS X-Ray daemon.
 type Client struct {
+	pool sync.Pool
+
+	muConfig sync.RWMutex
+	config   *clientConfig
+	closed   bool
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// clientConfig is the configure of Client that can be replaced by Reconfigure.
+type clientConfig struct {
 	// the address of the AWS X-Ray daemon
 	udp string
 
-	pool sync.Pool
-
 	disabled               bool
 	streamingStrategy      StreamingStrategy
 	samplingStrategy       sampling.Strategy
 	contextMissingStrategy ctxmissing.Strategy
+	deferSamplingDecision  bool
+	deferMaxSegments       int
+	tailSampler            *tailSampler
+	resourceARN            string
 
-	mu   sync.Mutex
-	conn net.Conn
+	// limits of annotations
+	maxAnnotationsPerSegment int
+	maxAnnotationsPerTrace   int
+	annotationOverflowPolicy AnnotationOverflowPolicy
+
+	// limits of metadata
+	maxMetadataBytesPerSegment int
+	maxMetadataDepth           int
+
+	// ownSamplingStrategy and ownStreamingStrategy are true if the client created the strategies,
+	// and the client is responsible for closing them.
+	ownSamplingStrategy  bool
+	ownStreamingStrategy bool
+
+	// inUse is read-locked while the strategies are in use,
+	// so that close waits for the in-flight requests.
+	inUse sync.RWMutex
 }
 
 // New returns a new Client.
 func New(config *Config) *Client {
+	cfg, err := newClientConfig(config)
+	if err != nil {
+		panic(err)
+	}
+	return newClient(cfg)
+}
+
+func newClient(cfg *clientConfig) *Client {
+	client := &Client{
+		pool: sync.Pool{
+			New: func() any {
+				return new(bytes.Buffer)
+			},
+		},
+		config: cfg,
+	}
+	return client
+}
+
+func newClientConfig(config *Config) (*clientConfig, error) {
+	return buildClientConfig(config, false)
+}
+
+// buildClientConfig builds the configure of Client.
+// If fallbackRulesFile is true, the error of loading AWS_XRAY_SAMPLING_RULES is logged,
+// and the centralized sampling strategy is used instead of returning the error.
+func buildClientConfig(config *Config, fallbackRulesFile bool) (*clientConfig, error) {
 	// initialize sampling strategy
 	p := config.daemonEndpoints()
 	var samplingStrategy sampling.Strategy
 	var contextMissingStrategy ctxmissing.Strategy
+	var ownSamplingStrategy bool
 	if config != nil {
 		samplingStrategy = config.SamplingStrategy
 		contextMissingStrategy = config.ContextMissingStrategy
 	}
 	if samplingStrategy == nil {
-		var err error
-		samplingStrategy, err = sampling.NewCentralizedStrategy(p.TCP, nil)
+		if path := os.Getenv("AWS_XRAY_SAMPLING_RULES"); path != "" {
+			s, err := sampling.NewFileStrategy(path)
+			if err != nil {
+				if !fallbackRulesFile {
+					return nil, err
+				}
+				xraylog.Errorf(context.Background(), "xray: failed to load AWS_XRAY_SAMPLING_RULES, fallback to the centralized sampling strategy: %v", err)
+			} else {
+				samplingStrategy = s
+				ownSamplingStrategy = true
+			}
+		}
+	}
+	if samplingStrategy == nil {
+		s, err := sampling.NewCentralizedStrategy(p.TCP, nil)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
+		samplingStrategy = s
+		ownSamplingStrategy = true
 	}
 	if contextMissingStrategy == nil {
 		switch os.Getenv("AWS_XRAY_CONTEXT_MISSING") {
@@ -89,35 +179,179 @@ func New(config *Config) *Client {
 	}
 
 	// initialize streaming strategy
-	streamingStrategy := NewStreamingStrategyLimitSubsegment(20)
+	var streamingStrategy StreamingStrategy
+	var ownStreamingStrategy bool
 	if config != nil && config.StreamingStrategy != nil {
 		streamingStrategy = config.StreamingStrategy
+	} else {
+		streamingStrategy = NewStreamingStrategyLimitSubsegment(20)
+		ownStreamingStrategy = true
 	}
 
-	client := &Client{
-		udp: p.UDP,
-		pool: sync.Pool{
-			New: func() any {
-				return new(bytes.Buffer)
-			},
-		},
-		disabled:               config.disabled(),
-		streamingStrategy:      streamingStrategy,
-		samplingStrategy:       samplingStrategy,
-		contextMissingStrategy: contextMissingStrategy,
+	var resourceARN string
+	if config != nil {
+		resourceARN = config.ResourceARN
 	}
-	return client
+
+	// initialize limits of annotations
+	maxAnnotationsPerTrace := DefaultMaxAnnotationsPerTrace
+	var maxAnnotationsPerSegment int
+	var annotationOverflowPolicy AnnotationOverflowPolicy
+	if config != nil {
+		if config.MaxAnnotationsPerTrace != 0 {
+			maxAnnotationsPerTrace = config.MaxAnnotationsPerTrace
+		}
+		maxAnnotationsPerSegment = config.MaxAnnotationsPerSegment
+		annotationOverflowPolicy = config.AnnotationOverflowPolicy
+	}
+
+	// initialize limits of metadata
+	maxMetadataBytesPerSegment := DefaultMaxMetadataBytesPerSegment
+	maxMetadataDepth := DefaultMaxMetadataDepth
+	if config != nil {
+		if config.MaxMetadataBytesPerSegment != 0 {
+			maxMetadataBytesPerSegment = config.MaxMetadataBytesPerSegment
+		}
+		if config.MaxMetadataDepth != 0 {
+			maxMetadataDepth = config.MaxMetadataDepth
+		}
+	}
+
+	var tailSampler *tailSampler
+	if config != nil {
+		tailSampler = newTailSampler(config.TailSampling)
+	}
+
+	deferMaxSegments := DefaultDeferSamplingDecisionMaxSegments
+	if config != nil && config.DeferSamplingDecisionMaxSegments > 0 {
+		deferMaxSegments = config.DeferSamplingDecisionMaxSegments
+	}
+
+	return &clientConfig{
+		udp:                        p.UDP,
+		disabled:                   config.disabled(),
+		streamingStrategy:          streamingStrategy,
+		samplingStrategy:           samplingStrategy,
+		contextMissingStrategy:     contextMissingStrategy,
+		deferSamplingDecision:      config != nil && config.DeferSamplingDecision,
+		deferMaxSegments:           deferMaxSegments,
+		tailSampler:                tailSampler,
+		resourceARN:                resourceARN,
+		maxAnnotationsPerSegment:   maxAnnotationsPerSegment,
+		maxAnnotationsPerTrace:     maxAnnotationsPerTrace,
+		annotationOverflowPolicy:   annotationOverflowPolicy,
+		maxMetadataBytesPerSegment: maxMetadataBytesPerSegment,
+		maxMetadataDepth:           maxMetadataDepth,
+		ownSamplingStrategy:        ownSamplingStrategy,
+		ownStreamingStrategy:       ownStreamingStrategy,
+	}, nil
+}
+
+// close closes the strategies that the client created.
+// It waits for the in-flight requests that have acquired cfg.
+func (cfg *clientConfig) close() error {
+	cfg.inUse.Lock()
+	defer cfg.inUse.Unlock()
+
+	var errs []error
+	if cfg.ownSamplingStrategy {
+		if c, ok := cfg.samplingStrategy.(io.Closer); ok {
+			errs = append(errs, c.Close())
+		}
+	}
+	if cfg.ownStreamingStrategy {
+		if c, ok := cfg.streamingStrategy.(io.Closer); ok {
+			errs = append(errs, c.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Reconfigure replaces the daemon address, the sampling strategy and the streaming strategy of the client with the cfg.
+// The segments that are in progress are emitted with the new configure.
+// If the old strategies were created by the client, they are closed
+// after the in-flight requests that are using them finish.
+// It returns [ErrClientClosed] if the client is already closed.
+func (c *Client) Reconfigure(cfg *Config) error {
+	return c.reconfigure(cfg, false)
+}
+
+// reconfigure replaces the configure of the client with the cfg.
+// If reopen is true, the closed client is reopened instead of returning [ErrClientClosed].
+func (c *Client) reconfigure(cfg *Config, reopen bool) error {
+	config, err := newClientConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	c.muConfig.Lock()
+	wasClosed := c.closed
+	if wasClosed && !reopen {
+		c.muConfig.Unlock()
+		config.close()
+		return ErrClientClosed
+	}
+	old := c.config
+	c.config = config
+	c.closed = false
+	c.muConfig.Unlock()
+
+	if wasClosed {
+		// Close has already closed the connection and the old configure.
+		return nil
+	}
+
+	// the daemon address may be changed.
+	// drop the current connection, and emit will dial the new address.
+	if old.udp != config.udp {
+		c.mu.Lock()
+		if c.conn != nil {
+			c.conn.Close()
+			c.conn = nil
+		}
+		c.mu.Unlock()
+	}
+
+	return old.close()
+}
+
+func (c *Client) getConfig() *clientConfig {
+	c.muConfig.RLock()
+	defer c.muConfig.RUnlock()
+	return c.config
+}
+
+// acquireConfig returns the current configure and the function to release it.
+// Reconfigure doesn't close the strategies of the configure until it is released.
+func (c *Client) acquireConfig() (*clientConfig, func()) {
+	c.muConfig.RLock()
+	defer c.muConfig.RUnlock()
+	config := c.config
+	config.inUse.RLock()
+	return config, config.inUse.RUnlock
+}
+
+func (c *Client) isClosed() bool {
+	c.muConfig.RLock()
+	defer c.muConfig.RUnlock()
+	return c.closed
 }
 
 // Emit sends seg to X-Ray daemon.
 func (c *Client) Emit(ctx context.Context, seg *Segment) {
-	for _, data := range c.streamingStrategy.StreamSegment(seg) {
+	if c.isClosed() {
+		xraylog.Errorf(ctx, "failed to emit: %v", ErrClientClosed)
+		return
+	}
+	config, release := c.acquireConfig()
+	defer release()
+	for _, data := range config.streamingStrategy.StreamSegment(seg) {
 		c.emit(ctx, data)
 	}
 }
 
 func (c *Client) emit(ctx context.Context, seg *schema.Segment) {
-	if c.disabled {
+	if c.getConfig().disabled {
 		return
 	}
 
@@ -134,11 +368,17 @@ func (c *Client) emit(ctx context.Context, seg *schema.Segment) {
 
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	if c.isClosed() {
+		// don't redial after the client is closed.
+		xraylog.Errorf(ctx, "failed to emit: %v", ErrClientClosed)
+		return
+	}
 	if c.conn == nil {
 		emitCtx, cancel := context.WithTimeout(context.Background(), emitTimeout)
 		defer cancel()
 
-		conn, err := dialer.DialContext(emitCtx, "udp", c.udp)
+		// read the address with holding c.mu, so that Reconfigure can close the connection to the old address.
+		conn, err := dialer.DialContext(emitCtx, "udp", c.getConfig().udp)
 		if err != nil {
 			xraylog.Errorf(ctx, "failed to dial: %v", err)
 			return
@@ -152,13 +392,25 @@ func (c *Client) emit(ctx context.Context, seg *schema.Segment) {
 }
 
 // Close closes the client.
+// It closes the connection to the daemon and the strategies that the client created.
+// Segments emitted after Close are dropped.
 func (c *Client) Close() error {
+	c.muConfig.Lock()
+	if c.closed {
+		c.muConfig.Unlock()
+		return nil
+	}
+	c.closed = true
+	config := c.config
+	c.muConfig.Unlock()
+
+	var errs []error
 	c.mu.Lock()
-	defer c.mu.Unlock()
 	if c.conn != nil {
-		err := c.conn.Close()
+		errs = append(errs, c.conn.Close())
 		c.conn = nil
-		return err
 	}
-	return nil
+	c.mu.Unlock()
+	errs = append(errs, config.close())
+	return errors.Join(errs...)
 }
@@ -1,8 +1,14 @@
 package xray
 
 import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/shogo82148/aws-xray-yasdk-go/xray/sampling"
 	"github.com/shogo82148/aws-xray-yasdk-go/xray/schema"
 )
 
@@ -25,3 +31,215 @@ func BenchmarkClient(b *testing.B) {
 		client.emit(ctx, seg)
 	}
 }
+
+func TestClient_Reconfigure(t *testing.T) {
+	ctx, td1 := NewTestDaemon(nil)
+	defer td1.Close()
+	_, td2 := NewTestDaemon(nil)
+	defer td2.Close()
+
+	client := ContextClient(ctx)
+	_, seg := BeginSegment(ctx, "first")
+	seg.Close()
+	if _, err := td1.Recv(); err != nil {
+		t.Fatal(err)
+	}
+
+	// begin a segment before reconfiguring, and close it after that.
+	_, seg = BeginSegment(ctx, "second")
+	if err := client.Reconfigure(&Config{
+		DaemonAddress:    td2.DaemonAddress(),
+		SamplingStrategy: sampling.NewAllStrategy(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	seg.Close()
+
+	got, err := td2.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "second" {
+		t.Errorf("want %q, got %q", "second", got.Name)
+	}
+}
+
+func TestClient_Reconfigure_InFlight(t *testing.T) {
+	ctx, td := NewTestDaemon(http.NotFoundHandler())
+	defer td.Close()
+
+	client := ContextClient(ctx)
+	if err := client.Reconfigure(&Config{
+		DaemonAddress: td.DaemonAddress(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the request that has acquired the configure before reconfiguring.
+	config, release := client.acquireConfig()
+	done := make(chan error, 1)
+	go func() {
+		done <- client.Reconfigure(&Config{
+			DaemonAddress: td.DaemonAddress(),
+		})
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("want waiting for the in-flight request, got %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	config.samplingStrategy.ShouldTrace(&sampling.Request{})
+	release()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClient_Reconfigure_Concurrent(t *testing.T) {
+	ctx, td := NewTestDaemon(http.NotFoundHandler())
+	defer td.Close()
+
+	client := ContextClient(ctx)
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				_, seg := BeginSegment(ctx, "concurrent")
+				seg.Close()
+			}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		if err := client.Reconfigure(&Config{
+			DaemonAddress: td.DaemonAddress(),
+		}); err != nil {
+			t.Error(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestClient_Reconfigure_Disabled(t *testing.T) {
+	ctx, td := NewTestDaemon(nil)
+	defer td.Close()
+
+	client := ContextClient(ctx)
+	if err := client.Reconfigure(&Config{
+		DaemonAddress:    td.DaemonAddress(),
+		SamplingStrategy: sampling.NewAllStrategy(),
+		Disabled:         true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	_, seg := BeginSegment(ctx, "disabled")
+	if seg != nil {
+		t.Error("want nil, got a segment")
+	}
+}
+
+func TestClient_Close(t *testing.T) {
+	ctx, td := NewTestDaemon(nil)
+	defer td.Close()
+
+	client := ContextClient(ctx)
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Close is idempotent.
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the client doesn't redial after it is closed.
+	_, seg := BeginSegment(ctx, "closed")
+	seg.Close()
+	if _, err := td.Recv(); err == nil {
+		t.Error("want error, got nil")
+	}
+	if client.conn != nil {
+		t.Error("want nil, got a connection")
+	}
+
+	if err := client.Reconfigure(nil); err != ErrClientClosed {
+		t.Errorf("want %v, got %v", ErrClientClosed, err)
+	}
+}
+
+func TestClient_Reopen(t *testing.T) {
+	ctx, td := NewTestDaemon(nil)
+	defer td.Close()
+
+	// Configure reopens the closed client.
+	client := ContextClient(ctx)
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.reconfigure(&Config{
+		DaemonAddress:    td.DaemonAddress(),
+		SamplingStrategy: sampling.NewAllStrategy(),
+	}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	_, seg := BeginSegment(ctx, "reopened")
+	seg.Close()
+	got, err := td.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "reopened" {
+		t.Errorf("want %q, got %q", "reopened", got.Name)
+	}
+}
+
+func TestNewClientConfig_SamplingRulesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sampling.json")
+	if err := os.WriteFile(path, []byte(`{"version": 2, "default": {"fixed_target": 1, "rate": 0.1}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_XRAY_SAMPLING_RULES", path)
+
+	cfg, err := newClientConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.close()
+	s, ok := cfg.samplingStrategy.(*sampling.FileStrategy)
+	if !ok {
+		t.Fatalf("want *sampling.FileStrategy, got %T", cfg.samplingStrategy)
+	}
+	if s.Path() != path {
+		t.Errorf("want %q, got %q", path, s.Path())
+	}
+
+	// the file that doesn't exist.
+	t.Setenv("AWS_XRAY_SAMPLING_RULES", filepath.Join(t.TempDir(), "not-found.json"))
+	if _, err := newClientConfig(nil); err == nil {
+		t.Error("want error, got nil")
+	}
+}
+
+func TestNewDefaultClient_SamplingRulesFileNotFound(t *testing.T) {
+	t.Setenv("AWS_XRAY_SAMPLING_RULES", filepath.Join(t.TempDir(), "not-found.json"))
+
+	// the default client is created at the package initialization, so it must not panic.
+	client := newDefaultClient()
+	defer client.Close()
+	if _, ok := client.getConfig().samplingStrategy.(*sampling.CentralizedStrategy); !ok {
+		t.Errorf("want *sampling.CentralizedStrategy, got %T", client.getConfig().samplingStrategy)
+	}
+
+	// the explicit configure returns the error.
+	if err := client.Reconfigure(nil); err == nil {
+		t.Error("want error, got nil")
+	}
+}
@@ -10,6 +10,9 @@ import (
 	"github.com/shogo82148/aws-xray-yasdk-go/xray/sampling"
 )
 
+// DefaultDeferSamplingDecisionMaxSegments is the default value of Config.DeferSamplingDecisionMaxSegments.
+const DefaultDeferSamplingDecisionMaxSegments = 100
+
 // Config is a configure for connecting AWS X-Ray daemon.
 type Config struct {
 	// DaemonAddress is the address for connecting AWS X-Ray daemon.
@@ -23,10 +26,64 @@ type Config struct {
 	Disabled bool
 
 	StreamingStrategy StreamingStrategy
-	SamplingStrategy  sampling.Strategy
+
+	// SamplingStrategy decides whether the requests are sampled.
+	// If it is nil and the AWS_XRAY_SAMPLING_RULES environment value is set,
+	// the SDK loads the local sampling rules from the file that the value points to,
+	// and reloads them when the file is changed. See [sampling.FileStrategy].
+	// Otherwise, the centralized sampling rules are used.
+	SamplingStrategy sampling.Strategy
+
+	// ResourceARN is the ARN of the AWS resource on which the application runs.
+	// It is used for matching the ResourceARN of the centralized sampling rules.
+	// If it is empty, the ARN that the plugins detect is used:
+	// the instance ARN by the EC2 plugin and the Elastic Beanstalk plugin, the container ARN by the ECS plugin,
+	// the cluster ARN by the EKS plugin, and the function ARN by the Lambda plugin.
+	ResourceARN string
+
+	// DeferSamplingDecision defers the sampling decision of root segments to downstream services.
+	// If it is true and the incoming request doesn't have any decision, the SDK records the segment,
+	// and propagates "Sampled=?" to downstream services.
+	// The decision that the downstream services return in the response is used.
+	// If no downstream service decides, the decision of SamplingStrategy is used.
+	//
+	// Every trace is recorded in memory until the decision is made, even if SamplingStrategy doesn't sample it.
+	// The memory is bounded by DeferSamplingDecisionMaxSegments per trace.
+	DeferSamplingDecision bool
+
+	// DeferSamplingDecisionMaxSegments is the maximum number of the segments and subsegments
+	// that a trace records while its sampling decision is deferred.
+	// Once the trace exceeds it, the decision of SamplingStrategy is used,
+	// and the subsegments of the trace that is not sampled are no longer recorded.
+	// Zero means DefaultDeferSamplingDecisionMaxSegments.
+	DeferSamplingDecisionMaxSegments int
+
+	// TailSampling enables tail sampling if it is not nil.
+	// See [TailSamplingConfig] for details.
+	TailSampling *TailSamplingConfig
 
 	// ContextMissingStrategy specifies the strategy to use when a segment is not associated with a context.
 	ContextMissingStrategy ctxmissing.Strategy
+
+	// MaxAnnotationsPerSegment is the maximum number of annotations in a segment or a subsegment.
+	// Zero means no limit.
+	MaxAnnotationsPerSegment int
+
+	// MaxAnnotationsPerTrace is the maximum number of annotations in a trace.
+	// Zero means DefaultMaxAnnotationsPerTrace, and negative values mean no limit.
+	MaxAnnotationsPerTrace int
+
+	// AnnotationOverflowPolicy specifies how to handle annotations that exceed the limits.
+	// The default is AnnotationOverflowDrop.
+	AnnotationOverflowPolicy AnnotationOverflowPolicy
+
+	// MaxMetadataBytesPerSegment is the maximum size of the JSON-encoded metadata in a segment or a subsegment.
+	// Zero means DefaultMaxMetadataBytesPerSegment, and negative values mean no limit.
+	MaxMetadataBytesPerSegment int
+
+	// MaxMetadataDepth is the maximum nesting depth of the JSON-encoded metadata values.
+	// Zero means DefaultMaxMetadataDepth, and negative values mean no limit.
+	MaxMetadataDepth int
 }
 
 type daemonEndpoints struct {
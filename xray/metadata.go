@@ -1,6 +1,8 @@
 package xray
 
 import (
+	"encoding/json"
+	"fmt"
 	"runtime"
 
 	"github.com/shogo82148/aws-xray-yasdk-go/xray/schema"
@@ -15,3 +17,81 @@ var ServiceData = &schema.Service{
 	Runtime:        runtime.Compiler,
 	RuntimeVersion: runtime.Version(),
 }
+
+const (
+	// DefaultMaxMetadataBytesPerSegment is the default budget of the JSON-encoded metadata in a segment.
+	// AWS X-Ray daemon accepts the documents up to 64KB, and the budget leaves room for other fields.
+	DefaultMaxMetadataBytesPerSegment = 16 * 1024
+
+	// DefaultMaxMetadataDepth is the default limit of the nesting depth of the metadata values.
+	DefaultMaxMetadataDepth = 32
+)
+
+// metadataFallback is the placeholder recorded instead of the metadata values that can't be recorded.
+type metadataFallback struct {
+	Type  string `json:"type,omitempty"`
+	Error string `json:"error"`
+}
+
+func metadataPlaceholder(typ string, err error) json.RawMessage {
+	data, err := json.Marshal(metadataFallback{
+		Type:  typ,
+		Error: err.Error(),
+	})
+	if err != nil {
+		panic(err) // metadataFallback is always encodable.
+	}
+	return data
+}
+
+// encodeMetadata encodes the value into JSON.
+// If the value is not encodable or is nested deeper than maxDepth,
+// it returns a placeholder that describes the reason.
+func encodeMetadata(value any, maxDepth int) (data json.RawMessage) {
+	defer func() {
+		// MarshalJSON methods of the users may panic.
+		if e := recover(); e != nil {
+			data = metadataPlaceholder(fmt.Sprintf("%T", value), fmt.Errorf("xray: panic while encoding metadata: %v", e))
+		}
+	}()
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return metadataPlaceholder(fmt.Sprintf("%T", value), err)
+	}
+	if maxDepth > 0 {
+		if depth := jsonDepth(data); depth > maxDepth {
+			return metadataPlaceholder(fmt.Sprintf("%T", value), fmt.Errorf("xray: metadata is nested too deeply: %d > %d", depth, maxDepth))
+		}
+	}
+	return data
+}
+
+// jsonDepth returns the maximum nesting depth of objects and arrays in the valid JSON data.
+func jsonDepth(data []byte) int {
+	var depth, maxDepth int
+	var inString, escaped bool
+	for _, b := range data {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case b == '\\':
+				escaped = true
+			case b == '"':
+				inString = false
+			}
+			continue
+		}
+		switch b {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+			maxDepth = max(maxDepth, depth)
+		case '}', ']':
+			depth--
+		}
+	}
+	return maxDepth
+}
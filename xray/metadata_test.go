@@ -0,0 +1,130 @@
+package xray
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/shogo82148/aws-xray-yasdk-go/xray/sampling"
+)
+
+func TestJSONDepth(t *testing.T) {
+	tc := []struct {
+		in   string
+		want int
+	}{
+		{in: `1`, want: 0},
+		{in: `"[{"`, want: 0},
+		{in: `{"a":1}`, want: 1},
+		{in: `{"a":[1,{"b":"\"}"}]}`, want: 3},
+		{in: `[[],[[]]]`, want: 3},
+	}
+	for _, tt := range tc {
+		got := jsonDepth([]byte(tt.in))
+		if got != tt.want {
+			t.Errorf("%s: want %d, got %d", tt.in, tt.want, got)
+		}
+	}
+}
+
+type cyclic struct {
+	Next *cyclic
+}
+
+type panicMarshaler struct{}
+
+func (panicMarshaler) MarshalJSON() ([]byte, error) {
+	panic("oops")
+}
+
+func TestAddMetadata(t *testing.T) {
+	nowFunc = fixedTime
+	defer func() { nowFunc = time.Now }()
+
+	ctx, td := NewTestDaemon(nil)
+	defer td.Close()
+
+	c := &cyclic{}
+	c.Next = c
+
+	ctx, seg := BeginSegment(ctx, "foobar")
+	AddMetadata(ctx, "string", "foo")
+	AddMetadata(ctx, "cyclic", c)
+	AddMetadata(ctx, "chan", make(chan int))
+	AddMetadata(ctx, "panic", panicMarshaler{})
+	AddMetadataToNamespace(ctx, "custom", "map", map[string]int{"a": 1})
+	seg.Close()
+
+	got, err := td.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"default": map[string]any{
+			"string": "foo",
+			"cyclic": map[string]any{
+				"type":  "*xray.cyclic",
+				"error": "json: unsupported value: encountered a cycle via *xray.cyclic",
+			},
+			"chan": map[string]any{
+				"type":  "chan int",
+				"error": "json: unsupported type: chan int",
+			},
+			"panic": map[string]any{
+				"type":  "xray.panicMarshaler",
+				"error": "xray: panic while encoding metadata: oops",
+			},
+		},
+		"custom": map[string]any{
+			"map": map[string]any{"a": 1.0},
+		},
+	}
+	if diff := cmp.Diff(want, got.Metadata); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestAddMetadata_Limits(t *testing.T) {
+	nowFunc = fixedTime
+	defer func() { nowFunc = time.Now }()
+
+	ctx, td := NewTestDaemon(nil)
+	defer td.Close()
+	if err := ContextClient(ctx).Reconfigure(&Config{
+		DaemonAddress:              td.DaemonAddress(),
+		SamplingStrategy:           sampling.NewAllStrategy(),
+		MaxMetadataBytesPerSegment: 200,
+		MaxMetadataDepth:           2,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, seg := BeginSegment(ctx, "foobar")
+	AddMetadata(ctx, "deep", [][][]int{{{1}}})
+	AddMetadata(ctx, "large", strings.Repeat("a", 1024))
+	AddMetadata(ctx, "small", "b")
+	AddMetadata(ctx, "small", "c") // overwriting doesn't consume the budget.
+	AddMetadata(ctx, "dropped", strings.Repeat("d", 1024))
+	seg.Close()
+
+	got, err := td.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"default": map[string]any{
+			"deep": map[string]any{
+				"type":  "[][][]int",
+				"error": "xray: metadata is nested too deeply: 3 > 2",
+			},
+			"large": map[string]any{
+				"error": "xray: metadata exceeds the budget of the segment: 1026 bytes",
+			},
+			"small": "c",
+		},
+	}
+	if diff := cmp.Diff(want, got.Metadata); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
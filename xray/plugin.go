@@ -21,9 +21,24 @@ type Plugin interface {
 	Origin() string
 }
 
+// ResourceARNPlugin is an optional interface of Plugin.
+// The plugins that know the ARN of the AWS resource on which the application runs implement it.
+// The ARN is used for matching the sampling rules.
+type ResourceARNPlugin interface {
+	Plugin
+
+	// ResourceARN returns the ARN of the AWS resource.
+	// If the plugin doesn't know the ARN, it returns empty string.
+	ResourceARN() string
+}
+
 var muPlugins sync.RWMutex
 var plugins []Plugin
 
+// the cache of resourceARN. AddPlugin clears it.
+var cachedResourceARN string
+var resourceARNCached bool
+
 // AddPlugin adds a plugin.
 func AddPlugin(plugin Plugin) {
 	if plugin == nil {
@@ -32,6 +47,7 @@ func AddPlugin(plugin Plugin) {
 	muPlugins.Lock()
 	defer muPlugins.Unlock()
 	plugins = append(plugins, plugin)
+	resourceARNCached = false
 }
 
 func getPlugins() []Plugin {
@@ -40,6 +56,51 @@ func getPlugins() []Plugin {
 	return plugins
 }
 
+// resourceARN returns the ARN of the AWS resource that the plugins detected.
+// If several plugins know the ARN, the plugin with the most representative origin wins.
+// The result is cached until a new plugin is added.
+func resourceARN() string {
+	muPlugins.RLock()
+	arn, cached := cachedResourceARN, resourceARNCached
+	muPlugins.RUnlock()
+	if cached {
+		return arn
+	}
+
+	muPlugins.Lock()
+	defer muPlugins.Unlock()
+	if !resourceARNCached {
+		cachedResourceARN = detectResourceARN(plugins)
+		resourceARNCached = true
+	}
+	return cachedResourceARN
+}
+
+// detectResourceARN returns the ARN that the plugins detected.
+func detectResourceARN(plugins []Plugin) string {
+	var arn string
+	priority := len(originPriority)
+	for _, p := range plugins {
+		rp, ok := p.(ResourceARNPlugin)
+		if !ok {
+			continue
+		}
+		a := rp.ResourceARN()
+		if a == "" {
+			continue
+		}
+		pr, ok := originPriority[rp.Origin()]
+		if !ok {
+			pr = len(originPriority)
+		}
+		if arn == "" || pr < priority {
+			arn = a
+			priority = pr
+		}
+	}
+	return arn
+}
+
 var _ Plugin = (*xrayPlugin)(nil)
 
 // xrayPlugin injects information about X-Ray YA-SDK.
@@ -3,6 +3,8 @@ package xray
 import (
 	"sync"
 	"testing"
+
+	"github.com/shogo82148/aws-xray-yasdk-go/xray/schema"
 )
 
 func TestAddPlugin(t *testing.T) {
@@ -11,6 +13,7 @@ func TestAddPlugin(t *testing.T) {
 		muPlugins.Lock()
 		defer muPlugins.Unlock()
 		plugins = org
+		resourceARNCached = false
 	}()
 	before := len(getPlugins())
 
@@ -35,3 +38,45 @@ func TestAddPlugin(t *testing.T) {
 		t.Errorf("unexpected plugin count: want %d, got %d", n, after-before)
 	}
 }
+
+type arnPlugin struct {
+	origin string
+	arn    string
+}
+
+func (p *arnPlugin) HandleSegment(seg *Segment, doc *schema.Segment) {}
+func (p *arnPlugin) Origin() string                                  { return p.origin }
+func (p *arnPlugin) ResourceARN() string                             { return p.arn }
+
+func TestResourceARN(t *testing.T) {
+	org := getPlugins()
+	defer func() {
+		muPlugins.Lock()
+		defer muPlugins.Unlock()
+		plugins = org
+		resourceARNCached = false
+	}()
+
+	if got := resourceARN(); got != "" {
+		t.Errorf("want empty, got %q", got)
+	}
+
+	AddPlugin(&arnPlugin{
+		origin: schema.OriginEC2Instance,
+		arn:    "arn:aws:ec2:ap-northeast-1:123456789012:instance/i-009df055e1f06d17f",
+	})
+	AddPlugin(&arnPlugin{
+		origin: schema.OriginECSContainer,
+		arn:    "arn:aws:ecs:ap-northeast-1:123456789012:container/example",
+	})
+	AddPlugin(&arnPlugin{
+		// the plugin doesn't know the ARN.
+		origin: schema.OriginElasticBeanstalk,
+	})
+
+	// ECS is more representative than EC2.
+	want := "arn:aws:ecs:ap-northeast-1:123456789012:container/example"
+	if got := resourceARN(); got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
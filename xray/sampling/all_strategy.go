@@ -3,7 +3,8 @@ package sampling
 // allStrategy samples all segments.
 func allStrategy(req *Request) *Decision {
 	return &Decision{
-		Sample: true,
+		Sample:    true,
+		DecidedBy: "all",
 	}
 }
 
@@ -12,6 +12,15 @@ type centralizedManifest struct {
 	Rules       []*centralizedRule
 	Quotas      map[string]*centralizedQuota
 	RefreshedAt time.Time
+
+	// ExpiresAt is when the rules loaded from the cache expire.
+	// It is zero if the rules are fetched from X-Ray.
+	ExpiresAt time.Time
+}
+
+// isExpired returns whether the rules must not be used at now.
+func (m *centralizedManifest) isExpired(now time.Time) bool {
+	return !m.ExpiresAt.IsZero() && !m.ExpiresAt.After(now)
 }
 
 type centralizedRule struct {
@@ -37,24 +46,45 @@ type centralizedRule struct {
 
 	// ServiceType for the sampling rule
 	serviceType string
+
+	// The ARN of the AWS resource on which the service runs.
+	resourceARN string
+
+	// Attributes that the request should have.
+	attributes map[string]string
 }
 
 func (r *centralizedRule) Match(req *Request) bool {
 	if req == nil {
 		return r.host == "*" && r.urlPath == "*" && r.httpMethod == "*" &&
-			r.serviceName == "*" && r.serviceType == "*"
+			r.serviceName == "*" && r.serviceType == "*" && r.resourceARN == "*" && len(r.attributes) == 0
 	}
 	return WildcardMatchCaseInsensitive(r.host, req.Host) &&
 		WildcardMatchCaseInsensitive(r.urlPath, req.URL) &&
 		WildcardMatchCaseInsensitive(r.httpMethod, req.Method) &&
 		WildcardMatchCaseInsensitive(r.serviceName, req.ServiceName) &&
-		WildcardMatchCaseInsensitive(r.serviceType, req.ServiceType)
+		WildcardMatchCaseInsensitive(r.serviceType, req.ServiceType) &&
+		WildcardMatchCaseInsensitive(r.resourceARN, req.ResourceARN) &&
+		matchAttributes(r.attributes, req.Attributes)
+}
+
+// matchAttributes returns whether the attributes match all patterns.
+// The attributes that are not in patterns are ignored.
+func matchAttributes(patterns, attributes map[string]string) bool {
+	for key, pattern := range patterns {
+		value, ok := attributes[key]
+		if !ok || !WildcardMatchCaseInsensitive(pattern, value) {
+			return false
+		}
+	}
+	return true
 }
 
 func (r *centralizedRule) Sample() *Decision {
 	return &Decision{
-		Rule:   &r.ruleName,
-		Sample: r.quota.Sample(),
+		Rule:      &r.ruleName,
+		Sample:    r.quota.Sample(),
+		DecidedBy: "centralized",
 	}
 }
 
@@ -91,12 +121,32 @@ type centralizedQuota struct {
 
 	// Unix epoch. Reservoir usage is reset every second.
 	currentEpoch int64
+
+	// The interval to report the statistics of the rule.
+	// Zero means defaultQuotaInterval.
+	interval time.Duration
+
+	// When the statistics of the rule should be reported next.
+	nextReport time.Time
+
+	// The statistics that are already reported.
+	reportedBorrowed int64
+	reportedRequests int64
+	reportedSampled  int64
+
+	// The statistics that are being reported.
+	pendingBorrowed int64
+	pendingRequests int64
+	pendingSampled  int64
 }
 
 func (q *centralizedQuota) update(doc *samplingTargetDocument) error {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 	q.fixedRate = doc.FixedRate
+	if doc.Interval > 0 {
+		q.interval = time.Duration(doc.Interval) * time.Second
+	}
 	q.quota = doc.ReservoirQuota
 	ttl, err := time.Parse(time.RFC3339Nano, doc.ReservoirQuotaTTL)
 	if err != nil {
@@ -173,6 +223,37 @@ func (q *centralizedQuota) randLocked() float64 {
 	return q.randFunc()
 }
 
+// isDue returns whether the statistics of the rule should be reported at now.
+func (q *centralizedQuota) isDue(now time.Time) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return !q.nextReport.After(now)
+}
+
+// reported schedules the next report after the statistics are reported at now.
+func (q *centralizedQuota) reported(now time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.reportedBorrowed += q.pendingBorrowed
+	q.reportedRequests += q.pendingRequests
+	q.reportedSampled += q.pendingSampled
+	q.pendingBorrowed = 0
+	q.pendingRequests = 0
+	q.pendingSampled = 0
+	interval := q.interval
+	if interval <= 0 {
+		interval = defaultQuotaInterval
+	}
+	q.nextReport = now.Add(interval)
+}
+
+// nextReportTime returns when the statistics of the rule should be reported next.
+func (q *centralizedQuota) nextReportTime() time.Time {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.nextReport
+}
+
 type centralizedQuotaStats struct {
 	// The number of requests recorded with borrowed reservoir quota.
 	borrowed int64
@@ -184,7 +265,21 @@ type centralizedQuotaStats struct {
 	sampled int64
 }
 
+// unreported restores the statistics that Stats returned, because reporting them failed.
+// They are reported with the next try.
+func (q *centralizedQuota) unreported() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.borrowed += q.pendingBorrowed
+	q.requests += q.pendingRequests
+	q.sampled += q.pendingSampled
+	q.pendingBorrowed = 0
+	q.pendingRequests = 0
+	q.pendingSampled = 0
+}
+
 // Stats returns the snapshot of statistics and reset it.
+// The statistics are pending until reported or unreported is called.
 func (q *centralizedQuota) Stats() centralizedQuotaStats {
 	q.mu.Lock()
 	defer q.mu.Unlock()
@@ -193,12 +288,28 @@ func (q *centralizedQuota) Stats() centralizedQuotaStats {
 		requests: q.requests,
 		sampled:  q.sampled,
 	}
+	q.pendingBorrowed += q.borrowed
+	q.pendingRequests += q.requests
+	q.pendingSampled += q.sampled
 	q.borrowed = 0
 	q.requests = 0
 	q.sampled = 0
 	return ret
 }
 
+// snapshot fills the quota and the statistics since the rule is loaded.
+func (q *centralizedQuota) snapshot(rule *RuleSnapshot) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	rule.FixedRate = q.fixedRate
+	rule.ReservoirQuota = q.quota
+	rule.ReservoirQuotaTTL = q.ttl
+	rule.Interval = int64(q.interval / time.Second)
+	rule.Borrowed = q.reportedBorrowed + q.pendingBorrowed + q.borrowed
+	rule.Requests = q.reportedRequests + q.pendingRequests + q.requests
+	rule.Sampled = q.reportedSampled + q.pendingSampled + q.sampled
+}
+
 type centralizedRuleSlice []*centralizedRule
 
 func (s centralizedRuleSlice) Len() int { return len(s) }
@@ -22,6 +22,7 @@ func TestCentralizedRule_Match(t *testing.T) {
 				urlPath:     "*",
 				serviceName: "*",
 				serviceType: "*",
+				resourceARN: "*",
 			},
 			want: true,
 		},
@@ -68,6 +69,90 @@ func TestCentralizedRule_Match(t *testing.T) {
 			},
 			want: true,
 		},
+		{
+			req: &Request{
+				Attributes: map[string]string{
+					"tenant": "Example",
+					"tier":   "premium",
+				},
+			},
+			rule: &centralizedRule{
+				ruleName:    "attributes",
+				host:        "*",
+				httpMethod:  "*",
+				urlPath:     "*",
+				serviceName: "*",
+				serviceType: "*",
+				attributes: map[string]string{
+					"tenant": "exam*",
+				},
+			},
+			want: true,
+		},
+		{
+			req: &Request{
+				Attributes: map[string]string{
+					"tenant": "other",
+				},
+			},
+			rule: &centralizedRule{
+				ruleName:    "attributes mismatch",
+				host:        "*",
+				httpMethod:  "*",
+				urlPath:     "*",
+				serviceName: "*",
+				serviceType: "*",
+				attributes: map[string]string{
+					"tenant": "exam*",
+				},
+			},
+			want: false,
+		},
+		{
+			req: &Request{},
+			rule: &centralizedRule{
+				ruleName:    "attributes missing",
+				host:        "*",
+				httpMethod:  "*",
+				urlPath:     "*",
+				serviceName: "*",
+				serviceType: "*",
+				attributes: map[string]string{
+					"tenant": "*",
+				},
+			},
+			want: false,
+		},
+		{
+			req: &Request{
+				ResourceARN: "arn:aws:ec2:ap-northeast-1:123456789012:instance/i-009df055e1f06d17f",
+			},
+			rule: &centralizedRule{
+				ruleName:    "resource arn",
+				host:        "*",
+				httpMethod:  "*",
+				urlPath:     "*",
+				serviceName: "*",
+				serviceType: "*",
+				resourceARN: "arn:aws:ec2:*:instance/*",
+			},
+			want: true,
+		},
+		{
+			req: &Request{
+				ResourceARN: "arn:aws:ecs:ap-northeast-1:123456789012:container/example",
+			},
+			rule: &centralizedRule{
+				ruleName:    "resource arn mismatch",
+				host:        "*",
+				httpMethod:  "*",
+				urlPath:     "*",
+				serviceName: "*",
+				serviceType: "*",
+				resourceARN: "arn:aws:ec2:*:instance/*",
+			},
+			want: false,
+		},
 	}
 	for _, tt := range tc {
 		if tt.rule.Match(tt.req) != tt.want {
@@ -7,10 +7,10 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"math/rand"
 	"net"
 	"net/http"
-	"net/netip"
 	"sort"
 	"sync"
 	"time"
@@ -18,19 +18,31 @@ import (
 	"github.com/shogo82148/aws-xray-yasdk-go/xray/xraylog"
 )
 
-var client = &http.Client{
-	Transport: &http.Transport{
-		Proxy: nil, // ignore proxy configure from the environment values
-		DialContext: (&net.Dialer{
-			Timeout:   10 * time.Second,
-			KeepAlive: 30 * time.Second,
-			DualStack: true,
-		}).DialContext,
-		MaxIdleConns:          5,
-		IdleConnTimeout:       90 * time.Second,
-		TLSHandshakeTimeout:   10 * time.Second,
-		ExpectContinueTimeout: time.Second,
-	},
+const (
+	// defaultQuotaInterval is the interval to report the statistics
+	// until X-Ray specifies the interval of the rule.
+	defaultQuotaInterval = 10 * time.Second
+
+	// minBackoff and maxBackoff are the range of the delay for retrying after failures.
+	minBackoff = time.Second
+	maxBackoff = 5 * time.Minute
+)
+
+func newHTTPClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy: nil, // ignore proxy configure from the environment values
+			DialContext: (&net.Dialer{
+				Timeout:   10 * time.Second,
+				KeepAlive: 30 * time.Second,
+				DualStack: true,
+			}).DialContext,
+			MaxIdleConns:          5,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		},
+	}
 }
 
 // https://docs.aws.amazon.com/xray/latest/api/API_GetSamplingRules.html#API_GetSamplingRules_RequestBody
@@ -170,17 +182,36 @@ type CentralizedStrategy struct {
 	// Sampling strategy used if centralized manifest is expired
 	fallback *LocalizedStrategy
 
-	// Address for X-Ray daemon
-	addr string
+	// The base URL of the sampling APIs.
+	// It is the X-Ray daemon, or the AWS X-Ray API endpoint.
+	endpoint string
+
+	// signer signs the requests to the AWS X-Ray API.
+	// It is nil if the requests are sent to the X-Ray daemon.
+	signer *apiSigner
 
 	// Unique ID used by XRay service to identify this client
 	clientID string
 
+	// HTTP client for calling the sampling APIs
+	httpClient *http.Client
+
 	// control poller
 	pollerCtx    context.Context
 	pollerCancel context.CancelFunc
+	pollerWG     sync.WaitGroup
+	muPoller     sync.Mutex
+	closed       bool // guarded by muPoller
 	startOnce    sync.Once
+	closeOnce    sync.Once
 	muRefresh    sync.Mutex
+	ruleRefresh  chan struct{}
+
+	// cache persists the sampling rules. It is nil if the cache is disabled.
+	cache *ruleCache
+
+	// exclusion filters the requests that are never sampled.
+	exclusion exclusionFilter
 
 	mu       sync.RWMutex
 	manifest *centralizedManifest
@@ -202,17 +233,21 @@ func NewCentralizedStrategy(addr string, manifest *Manifest) (*CentralizedStrate
 
 	pollerCtx, pollerCancel := context.WithCancel(context.Background())
 
-	return &CentralizedStrategy{
+	s := &CentralizedStrategy{
 		fallback:     local,
-		addr:         addr,
+		endpoint:     "http://" + addr,
 		clientID:     hex.EncodeToString(r[:]),
+		httpClient:   newHTTPClient(),
 		pollerCtx:    pollerCtx,
 		pollerCancel: pollerCancel,
+		ruleRefresh:  make(chan struct{}, 1),
 		manifest: &centralizedManifest{
 			Rules:  []*centralizedRule{},
 			Quotas: make(map[string]*centralizedQuota),
 		},
-	}, nil
+	}
+	s.exclusion.set(DefaultExclusion)
+	return s, nil
 }
 
 func (s *CentralizedStrategy) getSamplingRulesPages(ctx context.Context, input *getSamplingRulesInput, callback func(*getSamplingRulesOutput, bool) bool) error {
@@ -237,29 +272,10 @@ func (s *CentralizedStrategy) getSamplingRulesPages(ctx context.Context, input *
 //
 // https://docs.aws.amazon.com/xray/latest/api/API_GetSamplingRules.html
 func (s *CentralizedStrategy) getSamplingRules(ctx context.Context, input *getSamplingRulesInput) (*getSamplingRulesOutput, error) {
-	data, err := json.Marshal(input)
-	if err != nil {
-		return nil, err
-	}
-	req, err := http.NewRequest(http.MethodPost, "http://"+s.addr+"/GetSamplingRules", bytes.NewReader(data))
-	if err != nil {
-		return nil, err
-	}
-	req = req.WithContext(ctx)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	dec := json.NewDecoder(resp.Body)
 	var output getSamplingRulesOutput
-	if err := dec.Decode(&output); err != nil {
+	if err := s.callAPI(ctx, "/GetSamplingRules", input, &output); err != nil {
 		return nil, err
 	}
-
 	return &output, nil
 }
 
@@ -267,48 +283,74 @@ func (s *CentralizedStrategy) getSamplingRules(ctx context.Context, input *getSa
 //
 // https://docs.aws.amazon.com/xray/latest/api/API_GetSamplingTargets.html
 func (s *CentralizedStrategy) getSamplingTargets(ctx context.Context, input *getSamplingTargetsInput) (*getSamplingTargetsOutput, error) {
+	var output getSamplingTargetsOutput
+	if err := s.callAPI(ctx, "/SamplingTargets", input, &output); err != nil {
+		return nil, err
+	}
+	return &output, nil
+}
+
+func (s *CentralizedStrategy) callAPI(ctx context.Context, path string, input, output any) error {
 	data, err := json.Marshal(input)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	req, err := http.NewRequest(http.MethodPost, "http://"+s.addr+"/SamplingTargets", bytes.NewReader(data))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint+path, bytes.NewReader(data))
 	if err != nil {
-		return nil, err
+		return err
 	}
-	req = req.WithContext(ctx)
 	req.Header.Set("Content-Type", "application/json")
+	if s.signer != nil {
+		if err := s.signer.sign(ctx, req, data); err != nil {
+			return err
+		}
+	}
 
-	resp, err := client.Do(req)
+	resp, err := s.httpClient.Do(req)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("xray/sampling: unexpected status code: %d", resp.StatusCode)
+	}
 
 	dec := json.NewDecoder(resp.Body)
-	var output getSamplingTargetsOutput
-	if err := dec.Decode(&output); err != nil {
-		return nil, err
-	}
+	return dec.Decode(output)
+}
 
-	return &output, nil
+// Close stops polling, and waits for the pollers to exit.
+// It implements [io.Closer].
+func (s *CentralizedStrategy) Close() error {
+	s.closeOnce.Do(func() {
+		// no pollers start after this, so pollerWG.Add never races with pollerWG.Wait.
+		s.muPoller.Lock()
+		s.closed = true
+		s.pollerCancel()
+		s.muPoller.Unlock()
+
+		s.pollerWG.Wait()
+		s.httpClient.CloseIdleConnections()
+	})
+	return nil
 }
 
-// Close stops polling.
-func (s *CentralizedStrategy) Close() {
-	s.pollerCancel()
+// SetExclusion configures the requests that are never sampled.
+// By default, DefaultExclusion is used, unlike LocalizedStrategy and FileStrategy that exclude no requests.
+// A nil e excludes no requests.
+func (s *CentralizedStrategy) SetExclusion(e *Exclusion) {
+	s.exclusion.set(e)
 }
 
 // ShouldTrace implements Strategy.
 func (s *CentralizedStrategy) ShouldTrace(req *Request) *Decision {
-	if isDirectIPAccess(req) {
-		return &Decision{
-			Sample: false,
-		}
+	if sd := s.exclusion.apply(req); sd != nil {
+		return sd
 	}
 
 	s.startOnce.Do(s.start)
 	manifest := s.getManifest()
-	if manifest == nil {
+	if manifest == nil || manifest.isExpired(time.Now()) {
 		return s.fallback.ShouldTrace(req)
 	}
 
@@ -324,21 +366,6 @@ func (s *CentralizedStrategy) ShouldTrace(req *Request) *Decision {
 	return s.fallback.ShouldTrace(req)
 }
 
-// Nowadays, access using virtual host functionality is mostly used,
-// and there are few cases where access is made by directly specifying an IP address.
-// Therefore, if access is made by directly specifying an IP address,
-// we do not perform sampling.
-func isDirectIPAccess(req *Request) bool {
-	hostport := req.Host
-	host, _, err := net.SplitHostPort(hostport)
-	if err != nil {
-		host = hostport
-	}
-
-	_, err = netip.ParseAddr(host)
-	return err == nil
-}
-
 func (s *CentralizedStrategy) getManifest() *centralizedManifest {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -353,47 +380,78 @@ func (s *CentralizedStrategy) setManifest(manifest *centralizedManifest) {
 
 // start should be called by `s.startOnce.Do(s.start)“
 func (s *CentralizedStrategy) start() {
-	go s.rulePoller()
-	go s.quotaPoller()
+	s.muPoller.Lock()
+	defer s.muPoller.Unlock()
+	if s.closed {
+		// the strategy is already closed.
+		return
+	}
+	s.goPoller(s.rulePoller)
+	s.goPoller(s.quotaPoller)
 }
 
-func (s *CentralizedStrategy) rulePoller() {
-	var seed int64
-	if err := binary.Read(crand.Reader, binary.BigEndian, &seed); err != nil {
-		// fallback to timestamp
-		seed = time.Now().UnixNano()
-	}
-	rnd := rand.New(rand.NewSource(seed))
-	interval := 300 * time.Second
-	jitter := int64(time.Second)
+// goPoller runs f in a new goroutine that Close waits for.
+func (s *CentralizedStrategy) goPoller(f func()) {
+	s.pollerWG.Add(1)
+	go func() {
+		defer s.pollerWG.Done()
+		f()
+	}()
+}
 
+// rulePoller fetches the sampling rules at first,
+// and then fetches them again only when a change of the rules is detected by refreshQuota.
+func (s *CentralizedStrategy) rulePoller() {
+	b := newBackoff()
 	for {
-		s.refreshRule()
+		if err := s.refreshRule(); err != nil {
+			wait := b.next()
+			xraylog.Debugf(s.pollerCtx, "xray/sampling: retry refreshing sampling rules after %s", wait)
+			timer := time.NewTimer(wait)
+			select {
+			case <-s.pollerCtx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			continue
+		}
+		b.reset()
 
-		timer := time.NewTimer(interval + time.Duration(rnd.Int63n(jitter)))
 		select {
 		case <-s.pollerCtx.Done():
-			timer.Stop()
 			return
-		case <-timer.C:
+		case <-s.ruleRefresh:
 		}
 	}
 }
 
-func (s *CentralizedStrategy) quotaPoller() {
-	var seed int64
-	if err := binary.Read(crand.Reader, binary.BigEndian, &seed); err != nil {
-		// fallback to timestamp
-		seed = time.Now().UnixNano()
+// requestRuleRefresh wakes up rulePoller.
+func (s *CentralizedStrategy) requestRuleRefresh() {
+	select {
+	case s.ruleRefresh <- struct{}{}:
+	default:
+		// the refresh is already requested.
 	}
-	rnd := rand.New(rand.NewSource(seed))
-	interval := 10 * time.Second
+}
+
+// quotaPoller reports the statistics of each rule at the interval that X-Ray specifies.
+func (s *CentralizedStrategy) quotaPoller() {
+	b := newBackoff()
 	jitter := int64(100 * time.Millisecond)
 
 	for {
-		s.refreshQuota()
+		var wait time.Duration
+		next, err := s.refreshQuota()
+		if err != nil {
+			wait = b.next()
+			xraylog.Debugf(s.pollerCtx, "xray/sampling: retry refreshing sampling targets after %s", wait)
+		} else {
+			b.reset()
+			wait = max(time.Until(next), 0) + time.Duration(b.rnd.Int63n(jitter))
+		}
 
-		timer := time.NewTimer(interval + time.Duration(rnd.Int63n(jitter)))
+		timer := time.NewTimer(wait)
 		select {
 		case <-s.pollerCtx.Done():
 			timer.Stop()
@@ -403,7 +461,7 @@ func (s *CentralizedStrategy) quotaPoller() {
 	}
 }
 
-func (s *CentralizedStrategy) refreshRule() {
+func (s *CentralizedStrategy) refreshRule() (err error) {
 	ctx, cancel := context.WithTimeout(s.pollerCtx, time.Minute)
 	defer cancel()
 	s.muRefresh.Lock()
@@ -412,6 +470,7 @@ func (s *CentralizedStrategy) refreshRule() {
 		// avoid propagating panics to the application code.
 		if e := recover(); e != nil {
 			xraylog.Errorf(ctx, "panic: %v", e)
+			err = fmt.Errorf("xray/sampling: panic: %v", e)
 		}
 	}()
 
@@ -419,7 +478,8 @@ func (s *CentralizedStrategy) refreshRule() {
 	manifest := s.getManifest()
 	rules := make([]*centralizedRule, 0, len(manifest.Rules))
 	quotas := make(map[string]*centralizedQuota, len(manifest.Rules))
-	err := s.getSamplingRulesPages(ctx, &getSamplingRulesInput{}, func(out *getSamplingRulesOutput, lastPage bool) bool {
+	records := make([]*samplingRule, 0, len(manifest.Rules))
+	err = s.getSamplingRulesPages(ctx, &getSamplingRulesInput{}, func(out *getSamplingRulesOutput, lastPage bool) bool {
 		for _, record := range out.SamplingRuleRecords {
 			r := record.SamplingRule
 			name := r.RuleName
@@ -431,42 +491,66 @@ func (s *CentralizedStrategy) refreshRule() {
 					fixedRate: r.FixedRate,
 				}
 			}
-			rule := &centralizedRule{
-				quota:       quota,
-				ruleName:    name,
-				priority:    r.Priority,
-				host:        r.Host,
-				urlPath:     r.URLPath,
-				httpMethod:  r.HTTPMethod,
-				serviceName: r.ServiceName,
-				serviceType: r.ServiceType,
-			}
+			rule := newCentralizedRule(&r, quota)
 			rules = append(rules, rule)
+			records = append(records, &r)
 			quotas[name] = quota
 			xraylog.Debugf(
 				ctx,
-				"Refresh Sampling Rule: Priority: %d, ServiceName: %s, ServiceType: %s, Name: %s, Host: %s, URL: %s, Method: %s, Quota: %d, FixedRate: %f",
-				r.Priority, r.ServiceName, r.ServiceType,
-				name, r.Host, r.HTTPMethod, r.URLPath, quota.quota, r.FixedRate,
+				"Refresh Sampling Rule: Priority: %d, ServiceName: %s, ServiceType: %s, ResourceARN: %s, Name: %s, Host: %s, URL: %s, Method: %s, Attributes: %v, Quota: %d, FixedRate: %f",
+				r.Priority, r.ServiceName, r.ServiceType, rule.resourceARN,
+				name, r.Host, r.HTTPMethod, r.URLPath, r.Attributes, quota.quota, r.FixedRate,
 			)
 		}
 		return true
 	})
 	if err != nil {
 		xraylog.Errorf(ctx, "xray/sampling: failed to get sampling rules: %v", err)
-		return
+		return err
 	}
 	sort.Stable(centralizedRuleSlice(rules))
 
+	now := time.Now()
 	s.setManifest(&centralizedManifest{
 		Rules:       rules,
 		Quotas:      quotas,
-		RefreshedAt: time.Now(),
+		RefreshedAt: now,
 	})
 	xraylog.Debug(ctx, "sampling rules are refreshed.")
+
+	if s.cache != nil {
+		if err := s.cache.save(records, now); err != nil {
+			// the cache is best effort. the rules are already refreshed.
+			xraylog.Errorf(ctx, "xray/sampling: failed to save the sampling rule cache: %v", err)
+		}
+	}
+	return nil
 }
 
-func (s *CentralizedStrategy) refreshQuota() {
+// newCentralizedRule converts the sampling rule that X-Ray returns.
+func newCentralizedRule(r *samplingRule, quota *centralizedQuota) *centralizedRule {
+	resourceARN := r.ResourceARN
+	if resourceARN == "" {
+		// X-Ray always returns the resource ARN, but be careful.
+		resourceARN = "*"
+	}
+	return &centralizedRule{
+		quota:       quota,
+		ruleName:    r.RuleName,
+		priority:    r.Priority,
+		host:        r.Host,
+		urlPath:     r.URLPath,
+		httpMethod:  r.HTTPMethod,
+		serviceName: r.ServiceName,
+		serviceType: r.ServiceType,
+		resourceARN: resourceARN,
+		attributes:  r.Attributes,
+	}
+}
+
+// refreshQuota reports the statistics of the rules that are due,
+// and returns when it should be called next.
+func (s *CentralizedStrategy) refreshQuota() (next time.Time, err error) {
 	// maximum number of targets of GetSamplingTargets API
 	const maxTargets = 25
 
@@ -478,13 +562,18 @@ func (s *CentralizedStrategy) refreshQuota() {
 		// avoid propagating panics to the application code.
 		if e := recover(); e != nil {
 			xraylog.Errorf(ctx, "panic: %v", e)
+			err = fmt.Errorf("xray/sampling: panic: %v", e)
 		}
 	}()
 
 	manifest := s.getManifest()
 	now := time.Now()
 	stats := make([]*samplingStatisticsDocument, 0, len(manifest.Rules))
+	quotas := make([]*centralizedQuota, 0, len(manifest.Rules))
 	for _, r := range manifest.Rules {
+		if !r.quota.isDue(now) {
+			continue
+		}
 		stat := r.quota.Stats()
 		stats = append(stats, &samplingStatisticsDocument{
 			ClientID:     s.clientID,
@@ -494,6 +583,7 @@ func (s *CentralizedStrategy) refreshQuota() {
 			BorrowCount:  stat.borrowed,
 			Timestamp:    now.Format(time.RFC3339),
 		})
+		quotas = append(quotas, r.quota)
 		xraylog.Debugf(
 			ctx,
 			"Sampling Statistics: Name: %s, Requests: %d, Borrowed: %d, Sampled: %d", r.ruleName, stat.requests, stat.borrowed, stat.sampled,
@@ -503,12 +593,19 @@ func (s *CentralizedStrategy) refreshQuota() {
 	var needRefresh bool
 	for len(stats) > 0 {
 		l := min(len(stats), maxTargets)
-		resp, err := s.getSamplingTargets(ctx, &getSamplingTargetsInput{
+		resp, e := s.getSamplingTargets(ctx, &getSamplingTargetsInput{
 			SamplingStatisticsDocuments: stats[:l],
 		})
 		stats = stats[l:]
-		if err != nil {
-			xraylog.Errorf(ctx, "failed to refresh sampling targets: %v", err)
+		reported := quotas[:l]
+		quotas = quotas[l:]
+		if e != nil {
+			// the rules stay due, and their statistics are reported with the next try.
+			xraylog.Errorf(ctx, "xray/sampling: failed to refresh sampling targets: %v", e)
+			for _, quota := range reported {
+				quota.unreported()
+			}
+			err = e
 			continue
 		}
 		for _, doc := range resp.SamplingTargetDocuments {
@@ -531,6 +628,9 @@ func (s *CentralizedStrategy) refreshQuota() {
 				needRefresh = true
 			}
 		}
+		for _, quota := range reported {
+			quota.reported(now)
+		}
 		// check the rules are updated.
 		lastModification := time.Unix(resp.LastRuleModification, 0)
 		needRefresh = needRefresh || manifest.RefreshedAt.IsZero() || lastModification.After(manifest.RefreshedAt)
@@ -538,10 +638,49 @@ func (s *CentralizedStrategy) refreshQuota() {
 
 	xraylog.Debug(ctx, "sampling targets are refreshed.")
 
-	// TODO update the interval.
-
 	if needRefresh {
 		xraylog.Debug(ctx, "changing sampling rules is detected. refresh them.")
-		go s.refreshRule()
+		s.requestRuleRefresh()
+	}
+
+	next = now.Add(defaultQuotaInterval)
+	for _, r := range manifest.Rules {
+		if t := r.quota.nextReportTime(); t.Before(next) {
+			next = t
+		}
+	}
+	return next, err
+}
+
+// backoff calculates the delay of retrying with exponential backoff and jitter.
+type backoff struct {
+	rnd     *rand.Rand
+	attempt int
+}
+
+func newBackoff() *backoff {
+	var seed int64
+	if err := binary.Read(crand.Reader, binary.BigEndian, &seed); err != nil {
+		// fallback to timestamp
+		seed = time.Now().UnixNano()
+	}
+	return &backoff{
+		rnd: rand.New(rand.NewSource(seed)),
 	}
 }
+
+// next returns the delay of the next try.
+// The delay is chosen randomly from [d/2, d), where d doubles from minBackoff up to maxBackoff.
+func (b *backoff) next() time.Duration {
+	d := maxBackoff
+	if b.attempt < 32 {
+		d = min(minBackoff<<b.attempt, maxBackoff)
+		b.attempt++
+	}
+	return d/2 + time.Duration(b.rnd.Int63n(int64(d/2)))
+}
+
+// reset resets the delay after a success.
+func (b *backoff) reset() {
+	b.attempt = 0
+}
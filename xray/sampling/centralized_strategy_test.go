@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -63,6 +64,9 @@ func TestCentralizedStrategy_refreshRule(t *testing.T) {
 					RuleARN:       "*",
 					ServiceName:   "FooBar",
 					ServiceType:   "AWS::EC2::Instance",
+					Attributes: map[string]string{
+						"tenant": "example",
+					},
 				},
 			},
 		},
@@ -94,6 +98,9 @@ func TestCentralizedStrategy_refreshRule(t *testing.T) {
 	if r.serviceType != "AWS::EC2::Instance" {
 		t.Errorf("unexpected service type: want %q, got %q", "AWS::EC2::Instance", r.serviceType)
 	}
+	if diff := cmp.Diff(map[string]string{"tenant": "example"}, r.attributes); diff != "" {
+		t.Errorf("unexpected attributes (-want +got):\n%s", diff)
+	}
 	quota := s.manifest.Quotas["Test"]
 	if quota == nil {
 		t.Error("want not nil, got nil")
@@ -217,6 +224,183 @@ func TestCentralizedStrategy_refreshQuota(t *testing.T) {
 	if quota.ttl.Unix() != 1000000000 {
 		t.Errorf("unexpected ttl: want %d, got %d", 1000000000, quota.ttl.Unix())
 	}
+	if quota.interval != 15*time.Second {
+		t.Errorf("unexpected interval: want %s, got %s", 15*time.Second, quota.interval)
+	}
+}
+
+func TestCentralizedStrategy_refreshQuota_Interval(t *testing.T) {
+	var lastModification int64
+	var reported []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var input *getSamplingTargetsInput
+		if err := json.NewDecoder(req.Body).Decode(&input); err != nil {
+			t.Errorf("decode error: %v", err)
+			http.Error(w, "decode error", http.StatusInternalServerError)
+			return
+		}
+		output := &getSamplingTargetsOutput{
+			LastRuleModification: lastModification,
+		}
+		for _, doc := range input.SamplingStatisticsDocuments {
+			reported = append(reported, doc.RuleName)
+			output.SamplingTargetDocuments = append(output.SamplingTargetDocuments, &samplingTargetDocument{
+				RuleName:          doc.RuleName,
+				ReservoirQuota:    1,
+				ReservoirQuotaTTL: "2001-09-09T01:46:40Z",
+				Interval:          60,
+			})
+		}
+		if err := json.NewEncoder(w).Encode(output); err != nil {
+			t.Errorf("encode error: %v", err)
+		}
+	}))
+	defer ts.Close()
+
+	s, err := NewCentralizedStrategy(strings.TrimPrefix(ts.URL, "http://"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshedAt := time.Now()
+	lastModification = refreshedAt.Add(-time.Hour).Unix()
+	due := &centralizedQuota{}
+	notDue := &centralizedQuota{
+		nextReport: refreshedAt.Add(time.Hour),
+	}
+	s.manifest = &centralizedManifest{
+		Rules: []*centralizedRule{
+			{quota: due, ruleName: "Due"},
+			{quota: notDue, ruleName: "NotDue"},
+		},
+		Quotas: map[string]*centralizedQuota{
+			"Due":    due,
+			"NotDue": notDue,
+		},
+		RefreshedAt: refreshedAt,
+	}
+
+	next, err := s.refreshQuota()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"Due"}, reported); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	// the next report of "Due" is scheduled by the interval that X-Ray returns.
+	if d := due.nextReport.Sub(refreshedAt); d < 60*time.Second || d > 61*time.Second {
+		t.Errorf("unexpected next report: %s", d)
+	}
+	// refreshQuota is called for the earliest rule, but not later than the default interval.
+	if d := next.Sub(refreshedAt); d < 0 || d > defaultQuotaInterval+time.Second {
+		t.Errorf("unexpected next: %s", d)
+	}
+	select {
+	case <-s.ruleRefresh:
+		t.Error("want the rules not to be refreshed, but refreshed")
+	default:
+	}
+
+	// the rules are modified.
+	lastModification = refreshedAt.Add(time.Hour).Unix()
+	notDue.nextReport = time.Time{}
+	reported = nil
+	if _, err := s.refreshQuota(); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"NotDue"}, reported); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	select {
+	case <-s.ruleRefresh:
+	default:
+		t.Error("want the rules to be refreshed, but not")
+	}
+}
+
+func TestCentralizedStrategy_refreshQuota_Error(t *testing.T) {
+	var fail atomic.Bool
+	fail.Store(true)
+	var got []*samplingStatisticsDocument
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if fail.Load() {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		var input *getSamplingTargetsInput
+		if err := json.NewDecoder(req.Body).Decode(&input); err != nil {
+			t.Errorf("decode error: %v", err)
+			http.Error(w, "decode error", http.StatusInternalServerError)
+			return
+		}
+		got = input.SamplingStatisticsDocuments
+		w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+
+	s, err := NewCentralizedStrategy(strings.TrimPrefix(ts.URL, "http://"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	quota := &centralizedQuota{
+		requests: 30,
+		sampled:  20,
+		borrowed: 10,
+	}
+	s.manifest = &centralizedManifest{
+		Rules: []*centralizedRule{
+			{quota: quota, ruleName: "FooBar"},
+		},
+		Quotas: map[string]*centralizedQuota{
+			"FooBar": quota,
+		},
+		RefreshedAt: time.Now(),
+	}
+
+	if _, err := s.refreshQuota(); err == nil {
+		t.Error("want error, but not")
+	}
+	// the rule is reported with the next try.
+	if !quota.isDue(time.Now()) {
+		t.Error("want the rule to be due, but not")
+	}
+	var snapshot RuleSnapshot
+	quota.snapshot(&snapshot)
+	if snapshot.Requests != 30 || snapshot.Sampled != 20 || snapshot.Borrowed != 10 {
+		t.Errorf("unexpected statistics: %+v", snapshot)
+	}
+
+	// the statistics of the failed try are not lost.
+	fail.Store(false)
+	if _, err := s.refreshQuota(); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("want %d documents, got %d", 1, len(got))
+	}
+	if got[0].RequestCount != 30 || got[0].SampledCount != 20 || got[0].BorrowCount != 10 {
+		t.Errorf("unexpected statistics: %+v", got[0])
+	}
+	quota.snapshot(&snapshot)
+	if snapshot.Requests != 30 || snapshot.Sampled != 20 || snapshot.Borrowed != 10 {
+		t.Errorf("unexpected statistics: %+v", snapshot)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	b := newBackoff()
+	want := minBackoff
+	for range 20 {
+		got := b.next()
+		if got < want/2 || got >= want {
+			t.Errorf("want [%s, %s), got %s", want/2, want, got)
+		}
+		want = min(want*2, maxBackoff)
+	}
+
+	b.reset()
+	if got := b.next(); got >= minBackoff {
+		t.Errorf("want less than %s, got %s", minBackoff, got)
+	}
 }
 
 func TestIsDirectIPAccess(t *testing.T) {
@@ -243,3 +427,58 @@ func TestIsDirectIPAccess(t *testing.T) {
 		}
 	}
 }
+
+func TestCentralizedStrategy_Close(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+
+	s, err := NewCentralizedStrategy(strings.TrimPrefix(ts.URL, "http://"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// start the pollers.
+	s.ShouldTrace(&Request{})
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.pollerCtx.Err(); err == nil {
+		t.Error("want the pollers to be stopped, but not")
+	}
+
+	// Close is idempotent.
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCentralizedStrategy_CloseWhileStarting(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+
+	for range 100 {
+		s, err := NewCentralizedStrategy(strings.TrimPrefix(ts.URL, "http://"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// start the pollers and close the strategy concurrently.
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			s.ShouldTrace(&Request{})
+		}()
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+		<-done
+
+		// the pollers must not be running after Close returns.
+		s.pollerWG.Wait()
+	}
+}
@@ -0,0 +1,174 @@
+package sampling
+
+import (
+	"sync"
+	"time"
+)
+
+// NewParentBasedStrategy returns the strategy that follows the decision of the upstream service.
+// If the upstream service didn't decide, root decides.
+func NewParentBasedStrategy(root Strategy) Strategy {
+	return StrategyFunc(func(req *Request) *Decision {
+		if req != nil && req.ParentSampled != nil {
+			return &Decision{
+				Sample:    *req.ParentSampled,
+				DecidedBy: "parent",
+			}
+		}
+		return root.ShouldTrace(req)
+	})
+}
+
+// NewConditionalStrategy returns the strategy that has no opinion on the requests that don't match cond.
+// The matched requests are decided by s.
+// It is useful for building the rules of [NewChainStrategy].
+func NewConditionalStrategy(cond func(req *Request) bool, s Strategy) Strategy {
+	return StrategyFunc(func(req *Request) *Decision {
+		if !cond(req) {
+			return nil
+		}
+		return s.ShouldTrace(req)
+	})
+}
+
+// NewChainStrategy returns the strategy that asks the strategies in order,
+// and returns the first decision.
+// The strategies that have no opinion are skipped.
+// If all of them have no opinion, it has no opinion too.
+func NewChainStrategy(strategies ...Strategy) Strategy {
+	return StrategyFunc(func(req *Request) *Decision {
+		for _, s := range strategies {
+			if d := s.ShouldTrace(req); d != nil {
+				return d
+			}
+		}
+		return nil
+	})
+}
+
+// NewSampleErrorsStrategy returns the strategy that always samples the failed requests.
+// The other requests are decided by s.
+// The failures are known only after the requests are processed,
+// so use it as TailSamplingConfig.Strategy of the xray package. See [Request.Error].
+func NewSampleErrorsStrategy(s Strategy) Strategy {
+	return StrategyFunc(func(req *Request) *Decision {
+		if req != nil && req.Error {
+			return &Decision{
+				Sample:    true,
+				DecidedBy: "error",
+			}
+		}
+		return s.ShouldTrace(req)
+	})
+}
+
+// NewAndStrategy returns the strategy that samples the requests only if all the strategies sample them.
+// The decision of the first strategy that doesn't sample is returned.
+// The strategies that have no opinion are skipped.
+func NewAndStrategy(strategies ...Strategy) Strategy {
+	return StrategyFunc(func(req *Request) *Decision {
+		var last *Decision
+		for _, s := range strategies {
+			d := s.ShouldTrace(req)
+			if d == nil {
+				continue
+			}
+			if !d.Sample {
+				return d
+			}
+			last = d
+		}
+		return last
+	})
+}
+
+// NewOrStrategy returns the strategy that samples the requests if any of the strategies samples them.
+// The decision of the first strategy that samples is returned.
+// The strategies that have no opinion are skipped.
+func NewOrStrategy(strategies ...Strategy) Strategy {
+	return StrategyFunc(func(req *Request) *Decision {
+		var last *Decision
+		for _, s := range strategies {
+			d := s.ShouldTrace(req)
+			if d == nil {
+				continue
+			}
+			if d.Sample {
+				return d
+			}
+			last = d
+		}
+		return last
+	})
+}
+
+// maxRateLimitKeys is the maximum number of keys that a RateLimitStrategy tracks.
+const maxRateLimitKeys = 1024
+
+// RateLimitStrategy samples at most the specified number of requests per second for each key.
+type RateLimitStrategy struct {
+	limit   int64
+	keyFunc func(req *Request) string
+
+	// returns current time.
+	nowFunc func() time.Time
+
+	mu         sync.Mutex
+	reservoirs map[string]*reservoir
+}
+
+// NewRateLimitStrategy returns the strategy that samples at most limit requests per second for each key.
+// keyFunc returns the key of the request, e.g. the route or the tenant.
+// Up to 1024 keys that are used in the current second are tracked,
+// and the requests of the other keys are not sampled.
+func NewRateLimitStrategy(limit int64, keyFunc func(req *Request) string) *RateLimitStrategy {
+	return &RateLimitStrategy{
+		limit:      limit,
+		keyFunc:    keyFunc,
+		reservoirs: make(map[string]*reservoir),
+	}
+}
+
+// ShouldTrace implements Strategy.
+func (s *RateLimitStrategy) ShouldTrace(req *Request) *Decision {
+	r := s.getReservoir(s.keyFunc(req))
+	return &Decision{
+		Sample:    r != nil && r.Take(),
+		DecidedBy: "rate-limit",
+	}
+}
+
+func (s *RateLimitStrategy) getReservoir(key string) *reservoir {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.reservoirs[key]; ok {
+		return r
+	}
+
+	if len(s.reservoirs) >= maxRateLimitKeys {
+		// forget the keys that are not used in the current second.
+		epoch := s.now().Unix()
+		for k, r := range s.reservoirs {
+			if r.epoch() != epoch {
+				delete(s.reservoirs, k)
+			}
+		}
+		if len(s.reservoirs) >= maxRateLimitKeys {
+			return nil
+		}
+	}
+
+	r := &reservoir{
+		nowFunc:  s.nowFunc,
+		capacity: s.limit,
+	}
+	s.reservoirs[key] = r
+	return r
+}
+
+func (s *RateLimitStrategy) now() time.Time {
+	if s.nowFunc != nil {
+		return s.nowFunc()
+	}
+	return time.Now()
+}
@@ -0,0 +1,197 @@
+package sampling
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func fixedStrategy(sample bool, name string) Strategy {
+	return StrategyFunc(func(req *Request) *Decision {
+		return &Decision{
+			Sample:    sample,
+			DecidedBy: name,
+		}
+	})
+}
+
+var noOpinionStrategy = StrategyFunc(func(req *Request) *Decision {
+	return nil
+})
+
+func TestCompositeStrategies(t *testing.T) {
+	sampled := true
+	notSampled := false
+	isHealthCheck := func(req *Request) bool {
+		return req.URL == "/healthz"
+	}
+
+	tests := []struct {
+		name     string
+		strategy Strategy
+		req      *Request
+		want     *Decision
+	}{
+		{
+			name:     "parent sampled",
+			strategy: NewParentBasedStrategy(fixedStrategy(false, "root")),
+			req:      &Request{ParentSampled: &sampled},
+			want:     &Decision{Sample: true, DecidedBy: "parent"},
+		},
+		{
+			name:     "parent not sampled",
+			strategy: NewParentBasedStrategy(fixedStrategy(true, "root")),
+			req:      &Request{ParentSampled: &notSampled},
+			want:     &Decision{Sample: false, DecidedBy: "parent"},
+		},
+		{
+			name:     "no parent",
+			strategy: NewParentBasedStrategy(fixedStrategy(true, "root")),
+			req:      &Request{},
+			want:     &Decision{Sample: true, DecidedBy: "root"},
+		},
+		{
+			name: "chain: the first rule matches",
+			strategy: NewChainStrategy(
+				NewConditionalStrategy(isHealthCheck, fixedStrategy(false, "health")),
+				fixedStrategy(true, "default"),
+			),
+			req:  &Request{URL: "/healthz"},
+			want: &Decision{Sample: false, DecidedBy: "health"},
+		},
+		{
+			name: "chain: fall through",
+			strategy: NewChainStrategy(
+				NewConditionalStrategy(isHealthCheck, fixedStrategy(false, "health")),
+				fixedStrategy(true, "default"),
+			),
+			req:  &Request{URL: "/"},
+			want: &Decision{Sample: true, DecidedBy: "default"},
+		},
+		{
+			name:     "chain: no opinion",
+			strategy: NewChainStrategy(noOpinionStrategy),
+			req:      &Request{},
+			want:     nil,
+		},
+		{
+			name:     "sample errors",
+			strategy: NewSampleErrorsStrategy(fixedStrategy(false, "root")),
+			req:      &Request{Error: true},
+			want:     &Decision{Sample: true, DecidedBy: "error"},
+		},
+		{
+			name:     "sample errors: no error",
+			strategy: NewSampleErrorsStrategy(fixedStrategy(false, "root")),
+			req:      &Request{},
+			want:     &Decision{Sample: false, DecidedBy: "root"},
+		},
+		{
+			name:     "and: all sample",
+			strategy: NewAndStrategy(fixedStrategy(true, "a"), noOpinionStrategy, fixedStrategy(true, "b")),
+			req:      &Request{},
+			want:     &Decision{Sample: true, DecidedBy: "b"},
+		},
+		{
+			name:     "and: one doesn't sample",
+			strategy: NewAndStrategy(fixedStrategy(true, "a"), fixedStrategy(false, "b"), fixedStrategy(false, "c")),
+			req:      &Request{},
+			want:     &Decision{Sample: false, DecidedBy: "b"},
+		},
+		{
+			name:     "or: one samples",
+			strategy: NewOrStrategy(fixedStrategy(false, "a"), fixedStrategy(true, "b"), fixedStrategy(true, "c")),
+			req:      &Request{},
+			want:     &Decision{Sample: true, DecidedBy: "b"},
+		},
+		{
+			name:     "or: none samples",
+			strategy: NewOrStrategy(fixedStrategy(false, "a"), noOpinionStrategy, fixedStrategy(false, "b")),
+			req:      &Request{},
+			want:     &Decision{Sample: false, DecidedBy: "b"},
+		},
+		{
+			name:     "or: no opinion",
+			strategy: NewOrStrategy(noOpinionStrategy),
+			req:      &Request{},
+			want:     nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.strategy.ShouldTrace(tt.req)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRateLimitStrategy(t *testing.T) {
+	now := time.Unix(1000000000, 0)
+	s := NewRateLimitStrategy(2, func(req *Request) string {
+		return req.Attributes["tenant"]
+	})
+	s.nowFunc = func() time.Time { return now }
+
+	count := func(tenant string, n int) int {
+		var sampled int
+		for range n {
+			d := s.ShouldTrace(&Request{
+				Attributes: map[string]string{"tenant": tenant},
+			})
+			if d.DecidedBy != "rate-limit" {
+				t.Errorf("want %q, got %q", "rate-limit", d.DecidedBy)
+			}
+			if d.Sample {
+				sampled++
+			}
+		}
+		return sampled
+	}
+
+	if got := count("foo", 10); got != 2 {
+		t.Errorf("want %d, got %d", 2, got)
+	}
+	// the limit is applied for each key.
+	if got := count("bar", 10); got != 2 {
+		t.Errorf("want %d, got %d", 2, got)
+	}
+
+	// the reservoirs are reset every second.
+	now = now.Add(time.Second)
+	if got := count("foo", 10); got != 2 {
+		t.Errorf("want %d, got %d", 2, got)
+	}
+}
+
+func TestRateLimitStrategy_TooManyKeys(t *testing.T) {
+	now := time.Unix(1000000000, 0)
+	var key int
+	s := NewRateLimitStrategy(1, func(req *Request) string {
+		key++
+		return string(rune(key))
+	})
+	s.nowFunc = func() time.Time { return now }
+
+	for range maxRateLimitKeys {
+		if !s.ShouldTrace(&Request{}).Sample {
+			t.Fatal("want true, got false")
+		}
+	}
+	// too many keys are used in the current second.
+	if s.ShouldTrace(&Request{}).Sample {
+		t.Error("want false, got true")
+	}
+
+	// the old keys are forgotten.
+	now = now.Add(time.Second)
+	if !s.ShouldTrace(&Request{}).Sample {
+		t.Error("want true, got false")
+	}
+	if len(s.reservoirs) != 1 {
+		t.Errorf("want %d, got %d", 1, len(s.reservoirs))
+	}
+}
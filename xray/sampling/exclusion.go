@@ -0,0 +1,96 @@
+package sampling
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"sync/atomic"
+
+	"github.com/shogo82148/aws-xray-yasdk-go/xray/xraylog"
+)
+
+// Exclusion describes the requests that are never sampled, e.g. health checks from load balancers.
+// The strategies have different defaults:
+// CentralizedStrategy uses DefaultExclusion, and LocalizedStrategy and FileStrategy exclude no requests
+// to keep sampling the requests that they sampled before the exclusion was configurable.
+// Use SetExclusion of each strategy to apply the same exclusion.
+type Exclusion struct {
+	// DirectIPAccess excludes the requests whose host is an IP address.
+	// Nowadays, access using virtual host functionality is mostly used,
+	// and there are few cases where access is made by directly specifying an IP address,
+	// e.g. health checks and scanners.
+	DirectIPAccess bool
+
+	// URLPaths are the patterns of the URL paths to exclude, e.g. "/health".
+	// The patterns may contain wildcards "*" and "?".
+	URLPaths []string
+
+	// UserAgents are the patterns of the user agents to exclude, e.g. "ELB-HealthChecker/*".
+	// The patterns may contain wildcards "*" and "?".
+	UserAgents []string
+}
+
+// DefaultExclusion is the exclusion that CentralizedStrategy uses by default.
+// It excludes direct IP access only.
+// LocalizedStrategy and FileStrategy don't use it by default.
+var DefaultExclusion = &Exclusion{
+	DirectIPAccess: true,
+}
+
+// reason returns why req is excluded.
+// It returns an empty string if req is not excluded.
+func (e *Exclusion) reason(req *Request) string {
+	if e == nil || req == nil {
+		return ""
+	}
+	if e.DirectIPAccess && isDirectIPAccess(req) {
+		return "direct IP access"
+	}
+	for _, pattern := range e.URLPaths {
+		if WildcardMatchCaseInsensitive(pattern, req.URL) {
+			return "URL path " + pattern
+		}
+	}
+	for _, pattern := range e.UserAgents {
+		if WildcardMatchCaseInsensitive(pattern, req.UserAgent) {
+			return "user agent " + pattern
+		}
+	}
+	return ""
+}
+
+func isDirectIPAccess(req *Request) bool {
+	hostport := req.Host
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport
+	}
+
+	_, err = netip.ParseAddr(host)
+	return err == nil
+}
+
+// exclusionFilter applies an Exclusion, and counts the excluded requests.
+type exclusionFilter struct {
+	exclusion atomic.Pointer[Exclusion]
+	excluded  atomic.Int64
+}
+
+func (f *exclusionFilter) set(e *Exclusion) {
+	f.exclusion.Store(e)
+}
+
+// apply returns the decision not to sample req if it is excluded.
+// It returns nil if req is not excluded.
+func (f *exclusionFilter) apply(req *Request) *Decision {
+	reason := f.exclusion.Load().reason(req)
+	if reason == "" {
+		return nil
+	}
+	f.excluded.Add(1)
+	xraylog.Debugf(context.Background(), "xray/sampling: the request is excluded by %s", reason)
+	return &Decision{
+		Sample:    false,
+		DecidedBy: "exclusion",
+	}
+}
@@ -0,0 +1,90 @@
+package sampling
+
+import "testing"
+
+func TestExclusion(t *testing.T) {
+	e := &Exclusion{
+		DirectIPAccess: true,
+		URLPaths:       []string{"/health", "/internal/*"},
+		UserAgents:     []string{"ELB-HealthChecker/*"},
+	}
+	tests := []struct {
+		req  *Request
+		want string
+	}{
+		{req: &Request{Host: "example.com", URL: "/"}, want: ""},
+		{req: &Request{Host: "192.0.2.1:80", URL: "/"}, want: "direct IP access"},
+		{req: &Request{Host: "example.com", URL: "/health"}, want: "URL path /health"},
+		{req: &Request{Host: "example.com", URL: "/internal/metrics"}, want: "URL path /internal/*"},
+		{req: &Request{Host: "example.com", URL: "/", UserAgent: "ELB-HealthChecker/2.0"}, want: "user agent ELB-HealthChecker/*"},
+		{req: nil, want: ""},
+	}
+	for _, tt := range tests {
+		if got := e.reason(tt.req); got != tt.want {
+			t.Errorf("%v: want %q, got %q", tt.req, tt.want, got)
+		}
+	}
+
+	var none *Exclusion
+	if got := none.reason(&Request{Host: "192.0.2.1"}); got != "" {
+		t.Errorf("want no exclusion, got %q", got)
+	}
+}
+
+func TestCentralizedStrategy_SetExclusion(t *testing.T) {
+	s, err := NewCentralizedStrategy("127.0.0.1:2000", &Manifest{
+		Version: 2,
+		Default: &Rule{FixedTarget: 0, Rate: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// direct IP access is excluded by default.
+	sd := s.ShouldTrace(&Request{Host: "192.0.2.1"})
+	if sd.Sample || sd.DecidedBy != "exclusion" {
+		t.Errorf("want excluded, got %#v", sd)
+	}
+
+	s.SetExclusion(nil)
+	sd = s.ShouldTrace(&Request{Host: "192.0.2.1"})
+	if !sd.Sample {
+		t.Errorf("want sampled, got %#v", sd)
+	}
+
+	if got := s.Snapshot().Excluded; got != 1 {
+		t.Errorf("want %d, got %d", 1, got)
+	}
+}
+
+func TestLocalizedStrategy_SetExclusion(t *testing.T) {
+	s, err := NewLocalizedStrategy(&Manifest{
+		Version: 2,
+		Default: &Rule{FixedTarget: 0, Rate: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// no requests are excluded by default.
+	if sd := s.ShouldTrace(&Request{Host: "192.0.2.1", URL: "/health"}); !sd.Sample {
+		t.Errorf("want sampled, got %#v", sd)
+	}
+
+	s.SetExclusion(&Exclusion{URLPaths: []string{"/health"}})
+	if sd := s.ShouldTrace(&Request{Host: "192.0.2.1", URL: "/health"}); sd.Sample || sd.DecidedBy != "exclusion" {
+		t.Errorf("want excluded, got %#v", sd)
+	}
+	if sd := s.ShouldTrace(&Request{Host: "192.0.2.1", URL: "/"}); !sd.Sample {
+		t.Errorf("want sampled, got %#v", sd)
+	}
+
+	snapshot := s.Snapshot()
+	if snapshot.Excluded != 1 {
+		t.Errorf("want %d, got %d", 1, snapshot.Excluded)
+	}
+	if snapshot.Default.Requests != 2 {
+		t.Errorf("want %d, got %d", 2, snapshot.Default.Requests)
+	}
+}
@@ -0,0 +1,186 @@
+package sampling
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/shogo82148/aws-xray-yasdk-go/xray/xraylog"
+)
+
+// DefaultFilePollInterval is the interval of checking the update of the manifest file.
+const DefaultFilePollInterval = 10 * time.Second
+
+// FileStrategy makes trace sampling decisions based on
+// a set of rules provided in a local JSON file, in the same way as [LocalizedStrategy].
+// It watches the file by polling its modification time, and reloads the rules when it is changed.
+// If reloading fails, the last good rules are used.
+type FileStrategy struct {
+	path     string
+	interval time.Duration
+
+	// control poller
+	pollerCtx    context.Context
+	pollerCancel context.CancelFunc
+	pollerWG     sync.WaitGroup
+	startOnce    sync.Once
+	closeOnce    sync.Once
+
+	// the state of the file that is loaded last.
+	muReload sync.Mutex
+	modTime  time.Time
+	size     int64
+	loadedAt time.Time
+
+	// exclusion filters the requests that are never sampled.
+	exclusion exclusionFilter
+
+	mu    sync.RWMutex
+	local *LocalizedStrategy
+}
+
+// NewFileStrategy returns new FileStrategy that loads the manifest from path.
+// The manifest file is checked every DefaultFilePollInterval.
+// It returns an error if the first loading fails.
+func NewFileStrategy(path string) (*FileStrategy, error) {
+	pollerCtx, pollerCancel := context.WithCancel(context.Background())
+	s := &FileStrategy{
+		path:         path,
+		interval:     DefaultFilePollInterval,
+		pollerCtx:    pollerCtx,
+		pollerCancel: pollerCancel,
+	}
+	if _, err := s.reload(); err != nil {
+		pollerCancel()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Path returns the path of the manifest file.
+func (s *FileStrategy) Path() string {
+	return s.path
+}
+
+// SetExclusion configures the requests that are never sampled.
+// By default, no requests are excluded, unlike CentralizedStrategy that uses DefaultExclusion.
+// Set DefaultExclusion to exclude the same requests as CentralizedStrategy.
+func (s *FileStrategy) SetExclusion(e *Exclusion) {
+	s.exclusion.set(e)
+}
+
+// ShouldTrace implements Strategy.
+func (s *FileStrategy) ShouldTrace(req *Request) *Decision {
+	if sd := s.exclusion.apply(req); sd != nil {
+		return sd
+	}
+	s.startOnce.Do(s.start)
+	return s.getLocal().ShouldTrace(req)
+}
+
+// Close stops watching the file.
+// It implements [io.Closer].
+func (s *FileStrategy) Close() error {
+	s.closeOnce.Do(func() {
+		s.pollerCancel()
+		s.pollerWG.Wait()
+	})
+	return nil
+}
+
+// Snapshot returns the current rules and their statistics.
+func (s *FileStrategy) Snapshot() *Snapshot {
+	snapshot := s.getLocal().Snapshot()
+	snapshot.Strategy = "file"
+	snapshot.Excluded = s.exclusion.excluded.Load()
+	s.muReload.Lock()
+	snapshot.RefreshedAt = s.loadedAt
+	s.muReload.Unlock()
+	return snapshot
+}
+
+func (s *FileStrategy) getLocal() *LocalizedStrategy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.local
+}
+
+func (s *FileStrategy) setLocal(local *LocalizedStrategy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.local = local
+}
+
+// start should be called by `s.startOnce.Do(s.start)`
+func (s *FileStrategy) start() {
+	if s.pollerCtx.Err() != nil {
+		// the strategy is already closed.
+		return
+	}
+	s.pollerWG.Add(1)
+	go func() {
+		defer s.pollerWG.Done()
+		s.poller()
+	}()
+}
+
+func (s *FileStrategy) poller() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.pollerCtx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := s.reload(); err != nil {
+			xraylog.Errorf(s.pollerCtx, "xray/sampling: failed to reload %s, keep the last good manifest: %v", s.path, err)
+		}
+	}
+}
+
+// reload loads the manifest file if it is modified.
+// It reports whether the manifest is updated.
+func (s *FileStrategy) reload() (bool, error) {
+	s.muReload.Lock()
+	defer s.muReload.Unlock()
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return false, err
+	}
+	modTime, size := info.ModTime(), info.Size()
+	if s.getLocal() != nil && modTime.Equal(s.modTime) && size == s.size {
+		// the file is not modified.
+		return false, nil
+	}
+
+	f, err := os.Open(s.path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	manifest, err := DecodeManifest(f)
+	if err != nil {
+		// don't retry the broken file until it is modified.
+		s.modTime, s.size = modTime, size
+		return false, fmt.Errorf("xray/sampling: failed to decode %s: %w", s.path, err)
+	}
+	local, err := NewLocalizedStrategy(manifest)
+	if err != nil {
+		s.modTime, s.size = modTime, size
+		return false, err
+	}
+	if old := s.getLocal(); old != nil {
+		local.inheritState(old)
+	}
+	s.setLocal(local)
+	s.modTime, s.size = modTime, size
+	s.loadedAt = time.Now()
+	xraylog.Debugf(s.pollerCtx, "xray/sampling: the sampling rules are loaded from %s", s.path)
+	return true, nil
+}
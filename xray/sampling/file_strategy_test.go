@@ -0,0 +1,121 @@
+package sampling
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var _ Strategy = (*FileStrategy)(nil)
+
+func writeManifestFile(t *testing.T, path, content string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileStrategy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sampling.json")
+	now := time.Now()
+	writeManifestFile(t, path, `{
+		"version": 2,
+		"rules": [
+			{"host": "*", "service_name": "*", "http_method": "GET", "url_path": "/health", "fixed_target": 0, "rate": 0},
+			{"host": "*", "service_name": "*", "http_method": "*", "url_path": "/api/*", "fixed_target": 1, "rate": 0}
+		],
+		"default": {"fixed_target": 0, "rate": 0}
+	}`, now)
+
+	s, err := NewFileStrategy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	api := &Request{Host: "example.com", Method: "GET", URL: "/api/users"}
+	if !s.ShouldTrace(api).Sample {
+		t.Error("want true, got false")
+	}
+
+	snapshot := s.Snapshot()
+	if snapshot.Strategy != "file" || snapshot.RefreshedAt.IsZero() {
+		t.Errorf("unexpected snapshot: %s, %s", snapshot.Strategy, snapshot.RefreshedAt)
+	}
+	if got := snapshot.Rules[1].Sampled; got != 1 {
+		t.Errorf("want %d, got %d", 1, got)
+	}
+
+	// not modified
+	updated, err := s.reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated {
+		t.Error("want not to be updated, but updated")
+	}
+
+	// the rule for /health is changed, and the rule for /api/* is not.
+	writeManifestFile(t, path, `{
+		"version": 2,
+		"rules": [
+			{"host": "*", "service_name": "*", "http_method": "GET", "url_path": "/health", "fixed_target": 0, "rate": 1},
+			{"description": "the description doesn't matter", "host": "*", "service_name": "*", "http_method": "*", "url_path": "/api/*", "fixed_target": 1, "rate": 0}
+		],
+		"default": {"fixed_target": 0, "rate": 0}
+	}`, now.Add(time.Second))
+	updated, err = s.reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !updated {
+		t.Error("want to be updated, but not")
+	}
+	if !s.ShouldTrace(&Request{Host: "example.com", Method: "GET", URL: "/health"}).Sample {
+		t.Error("want true, got false")
+	}
+	// the reservoir is already consumed in this second.
+	local := s.getLocal()
+	if local.reservoirs[1].currentEpoch == 0 {
+		t.Error("want the reservoir to be inherited, but not")
+	}
+
+	// broken manifest
+	writeManifestFile(t, path, `{"version": 2, "rules": []}`, now.Add(2*time.Second))
+	if _, err := s.reload(); err == nil {
+		t.Error("want error, got nil")
+	}
+	if s.getLocal() != local {
+		t.Error("want the last good manifest to be kept, but not")
+	}
+	// the broken file is not loaded again.
+	updated, err = s.reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated {
+		t.Error("want not to be updated, but updated")
+	}
+
+	// removed
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.reload(); err == nil {
+		t.Error("want error, got nil")
+	}
+	if s.getLocal() != local {
+		t.Error("want the last good manifest to be kept, but not")
+	}
+}
+
+func TestNewFileStrategy_NotFound(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "not-found.json")
+	if _, err := NewFileStrategy(path); err == nil {
+		t.Error("want error, got nil")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -17,10 +18,19 @@ type LocalizedStrategy struct {
 	manifest         *Manifest
 	reservoirs       []*reservoir
 	defaultReservoir *reservoir
+	counters         []*ruleCounter
+	defaultCounter   *ruleCounter
+	exclusion        exclusionFilter
 	mu               sync.Mutex
 	randFunc         func() float64
 }
 
+// ruleCounter counts the requests that match a rule.
+type ruleCounter struct {
+	requests atomic.Int64
+	sampled  atomic.Int64
+}
+
 // NewLocalizedStrategy returns new LocalizedStrategy.
 func NewLocalizedStrategy(manifest *Manifest) (*LocalizedStrategy, error) {
 	if manifest == nil {
@@ -32,10 +42,12 @@ func NewLocalizedStrategy(manifest *Manifest) (*LocalizedStrategy, error) {
 	cp := manifest.Copy()
 	cp.normalize()
 	reservoirs := make([]*reservoir, 0, len(cp.Rules))
+	counters := make([]*ruleCounter, 0, len(cp.Rules))
 	for _, r := range cp.Rules {
 		reservoirs = append(reservoirs, &reservoir{
 			capacity: r.FixedTarget,
 		})
+		counters = append(counters, &ruleCounter{})
 	}
 	defaultReservoir := &reservoir{
 		capacity: cp.Default.FixedTarget,
@@ -44,30 +56,78 @@ func NewLocalizedStrategy(manifest *Manifest) (*LocalizedStrategy, error) {
 		manifest:         cp,
 		reservoirs:       reservoirs,
 		defaultReservoir: defaultReservoir,
+		counters:         counters,
+		defaultCounter:   &ruleCounter{},
 	}, nil
 }
 
+// SetExclusion configures the requests that are never sampled.
+// By default, no requests are excluded, unlike CentralizedStrategy that uses DefaultExclusion.
+// Set DefaultExclusion to exclude the same requests as CentralizedStrategy.
+func (s *LocalizedStrategy) SetExclusion(e *Exclusion) {
+	s.exclusion.set(e)
+}
+
 // ShouldTrace implements Strategy.
 func (s *LocalizedStrategy) ShouldTrace(req *Request) *Decision {
+	if sd := s.exclusion.apply(req); sd != nil {
+		return sd
+	}
 	for i, r := range s.manifest.Rules {
 		if r.Match(req) {
-			return s.sampling(s.reservoirs[i], r.Rate)
+			return s.sampling(s.reservoirs[i], s.counters[i], r)
+		}
+	}
+	return s.sampling(s.defaultReservoir, s.defaultCounter, s.manifest.Default)
+}
+
+// inheritState takes over the reservoirs and the counters of the unchanged rules from old,
+// so that reloading the rules doesn't reset the consumption of the reservoirs.
+func (s *LocalizedStrategy) inheritState(old *LocalizedStrategy) {
+	used := make([]bool, len(old.manifest.Rules))
+	for i, r := range s.manifest.Rules {
+		for j, o := range old.manifest.Rules {
+			if !used[j] && r.equal(o) {
+				s.reservoirs[i] = old.reservoirs[j]
+				s.counters[i] = old.counters[j]
+				used[j] = true
+				break
+			}
 		}
 	}
-	return s.sampling(s.defaultReservoir, s.manifest.Default.Rate)
+	if s.manifest.Default.equal(old.manifest.Default) {
+		s.defaultReservoir = old.defaultReservoir
+		s.defaultCounter = old.defaultCounter
+	}
 }
 
-func (s *LocalizedStrategy) sampling(r *reservoir, rate float64) *Decision {
+func (s *LocalizedStrategy) sampling(r *reservoir, c *ruleCounter, rule *Rule) *Decision {
+	// the rules are named in the version 3.
+	var name *string
+	if s.manifest.Version == 3 {
+		name = &rule.Name
+	}
+
+	c.requests.Add(1)
 	if r.Take() {
+		c.sampled.Add(1)
 		return &Decision{
-			Sample: true,
+			Sample:    true,
+			Rule:      name,
+			DecidedBy: "localized",
 		}
 	}
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	sample := s.randLocked() < rule.Rate
+	if sample {
+		c.sampled.Add(1)
+	}
 	return &Decision{
-		Sample: s.randLocked() < rate,
+		Sample:    sample,
+		Rule:      name,
+		DecidedBy: "localized",
 	}
 }
 
@@ -57,3 +57,76 @@ func TestLocalizedStrategy(t *testing.T) {
 	}
 	testRate(req, 0.05)
 }
+
+func TestLocalizedStrategy_Version3(t *testing.T) {
+	s, err := NewLocalizedStrategy(&Manifest{
+		Version: 3,
+		Rules: []*Rule{
+			{
+				Name:     "all-users",
+				Priority: 20,
+				URLPath:  "/users/*",
+				Rate:     0,
+			},
+			{
+				Name:       "premium-users",
+				Priority:   10,
+				URLPath:    "/users/*",
+				Attributes: map[string]string{"tier": "premium"},
+				Rate:       1,
+			},
+			{
+				Name:        "worker",
+				Priority:    10,
+				ServiceType: "AWS::ECS::Container",
+				Rate:        1,
+			},
+		},
+		Default: &Rule{
+			Rate: 0,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.randFunc = func() float64 { return 0.5 }
+
+	tests := []struct {
+		req      *Request
+		wantRule string
+		want     bool
+	}{
+		{
+			// the rule with the smaller priority wins.
+			req:      &Request{Host: "example.com", Method: "GET", URL: "/users/42", Attributes: map[string]string{"tier": "premium"}},
+			wantRule: "premium-users",
+			want:     true,
+		},
+		{
+			req:      &Request{Host: "example.com", Method: "GET", URL: "/users/42", Attributes: map[string]string{"tier": "free"}},
+			wantRule: "all-users",
+			want:     false,
+		},
+		{
+			req:      &Request{ServiceName: "worker", ServiceType: "AWS::ECS::Container"},
+			wantRule: "worker",
+			want:     true,
+		},
+		{
+			// unlike the version 2, the rules don't ignore the parameters that the request doesn't have.
+			req:      &Request{ServiceName: "worker"},
+			wantRule: DefaultRuleName,
+			want:     false,
+		},
+	}
+	for _, tt := range tests {
+		sd := s.ShouldTrace(tt.req)
+		if sd.Rule == nil || *sd.Rule != tt.wantRule {
+			t.Errorf("%v: want rule %q, got %v", tt.req, tt.wantRule, sd.Rule)
+			continue
+		}
+		if sd.Sample != tt.want {
+			t.Errorf("%v: want %t, got %t", tt.req, tt.want, sd.Sample)
+		}
+	}
+}
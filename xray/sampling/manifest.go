@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"sort"
 )
 
 // Manifest is a list of sampling rules.
@@ -15,7 +17,19 @@ type Manifest struct {
 }
 
 // Rule is a sampling rule.
+// The patterns of the rule are wildcards by default.
+// In the version 3, the patterns with the "re:" prefix are regular expressions,
+// and the patterns with the "tmpl:" prefix are path templates, e.g. "tmpl:/users/{id}".
+// In the version 1 and 2, the prefixes have no special meaning, and the patterns are wildcards.
 type Rule struct {
+	// Name is the name of the rule. It is required in the version 3.
+	// The name is recorded as the sampling rule name of the segments that the rule samples.
+	Name string `json:"name,omitempty"`
+
+	// Priority is the priority of the rule in the version 3.
+	// The rules are evaluated in ascending order of the priority, and then in the order of the name.
+	Priority int64 `json:"priority,omitempty"`
+
 	// Description
 	Description string `json:"description"`
 
@@ -31,13 +45,33 @@ type Rule struct {
 	// The name of the instrumented service, as it appears in the service map.
 	ServiceName string `json:"service_name"`
 
+	// The origin of the instrumented service, e.g. AWS::EC2::Instance. It is available in the version 3.
+	ServiceType string `json:"service_type,omitempty"`
+
+	// Attributes that the request should have. It is available in the version 3.
+	Attributes map[string]string `json:"attributes,omitempty"`
+
 	// FixedTarget
 	FixedTarget int64 `json:"fixed_target"`
 
 	// The rate of matching requests to instrument, after the reservoir is exhausted.
 	Rate float64 `json:"rate"`
+
+	// strict is true if the rule matches in the same way as the centralized rules.
+	// It is set for the version 3.
+	strict bool
+
+	// extended is true if the "re:" and "tmpl:" prefixes are available.
+	// It is set for the version 3.
+	extended bool
+
+	// patterns are the compiled patterns. They are compiled when the manifest is loaded.
+	patterns *rulePatterns
 }
 
+// DefaultRuleName is the name of the default rule in the version 3, if the default rule has no name.
+const DefaultRuleName = "Default"
+
 // DefaultSamplingRule is default sampling rule, if centralized sampling rule is not available.
 var DefaultSamplingRule = &Manifest{
 	Version: 2,
@@ -58,6 +92,9 @@ func DecodeManifest(r io.Reader) (*Manifest, error) {
 	if err := manifest.Validate(); err != nil {
 		return nil, err
 	}
+	for _, r := range manifest.Rules {
+		r.extended = manifest.Version >= 3
+	}
 	return &manifest, nil
 }
 
@@ -66,7 +103,7 @@ func (m *Manifest) Validate() error {
 	if m == nil {
 		return errors.New("xray/sampling: sampling rule manifest must not be nil")
 	}
-	if m.Version != 1 && m.Version != 2 {
+	if m.Version != 1 && m.Version != 2 && m.Version != 3 {
 		return fmt.Errorf("xray/sampling: sampling rule manifest version %d not supported", m.Version)
 	}
 	if m.Default == nil {
@@ -75,6 +112,9 @@ func (m *Manifest) Validate() error {
 	if m.Default.URLPath != "" || m.Default.ServiceName != "" || m.Default.HTTPMethod != "" {
 		return errors.New("xray/sampling: the default rule must not specify values for url_path, service_name, or http_method")
 	}
+	if m.Version == 3 && (m.Default.Host != "" || m.Default.ServiceType != "" || len(m.Default.Attributes) > 0) {
+		return errors.New("xray/sampling: the default rule must not specify values for host, service_type, or attributes")
+	}
 	if m.Default.FixedTarget < 0 || m.Default.Rate < 0 {
 		return errors.New("xray/sampling: the default rule must specify non-negative values for fixed_target and rate")
 	}
@@ -97,18 +137,53 @@ func (m *Manifest) Validate() error {
 				return errors.New("xray/sampling: all non-default rules must have values for host, url_path, service_name, and http_method")
 			}
 		}
+	case 3:
+		names := map[string]struct{}{
+			m.defaultRuleName(): {},
+		}
+		for _, r := range m.Rules {
+			if r.Name == "" {
+				return errors.New("xray/sampling: all non-default rules must have a name")
+			}
+			if _, ok := names[r.Name]; ok {
+				return fmt.Errorf("xray/sampling: the rule name %q is duplicated", r.Name)
+			}
+			names[r.Name] = struct{}{}
+			if r.FixedTarget < 0 || r.Rate < 0 || r.Priority < 0 {
+				return errors.New("xray/sampling: all rules must have non-negative values for priority, fixed_target and rate")
+			}
+		}
 	default:
 		panic("do not pass")
 	}
+
+	for i, r := range m.Rules {
+		if _, err := r.compile(m.Version >= 3); err != nil {
+			name := r.Name
+			if name == "" {
+				name = fmt.Sprintf("#%d", i+1)
+			}
+			return fmt.Errorf("xray/sampling: the rule %s has invalid patterns: %w", name, err)
+		}
+	}
 	return nil
 }
 
+func (m *Manifest) defaultRuleName() string {
+	if m.Default.Name != "" {
+		return m.Default.Name
+	}
+	return DefaultRuleName
+}
+
 // Copy returns deep copy of the manifest.
 func (m *Manifest) Copy() *Manifest {
 	defaultRule := *m.Default
+	defaultRule.Attributes = maps.Clone(m.Default.Attributes)
 	rules := make([]*Rule, 0, len(m.Rules))
 	for _, r := range m.Rules {
 		r := *r
+		r.Attributes = maps.Clone(r.Attributes)
 		rules = append(rules, &r)
 	}
 	return &Manifest{
@@ -119,23 +194,89 @@ func (m *Manifest) Copy() *Manifest {
 }
 
 func (m *Manifest) normalize() {
-	if m.Version == 2 {
-		return
+	switch m.Version {
+	case 1:
+		m.Version = 2
+		for _, r := range m.Rules {
+			// service_name is renamed to host
+			r.Host = r.ServiceName
+			r.ServiceName = ""
+		}
+	case 3:
+		// the rules match in the same way as the centralized rules.
+		for _, r := range m.Rules {
+			r.strict = true
+			r.extended = true
+			r.Host = wildcardIfEmpty(r.Host)
+			r.HTTPMethod = wildcardIfEmpty(r.HTTPMethod)
+			r.URLPath = wildcardIfEmpty(r.URLPath)
+			r.ServiceName = wildcardIfEmpty(r.ServiceName)
+			r.ServiceType = wildcardIfEmpty(r.ServiceType)
+		}
+		sort.SliceStable(m.Rules, func(i, j int) bool {
+			a, b := m.Rules[i], m.Rules[j]
+			if a.Priority == b.Priority {
+				return a.Name < b.Name
+			}
+			return a.Priority < b.Priority
+		})
+		m.Default.Name = m.defaultRuleName()
 	}
-	m.Version = 2
+
+	// the patterns are already validated.
 	for _, r := range m.Rules {
-		// service_name is renamed to host
-		r.Host = r.ServiceName
-		r.ServiceName = ""
+		r.patterns, _ = r.compile(r.extended)
+	}
+}
+
+func wildcardIfEmpty(pattern string) string {
+	if pattern == "" {
+		return "*"
 	}
+	return pattern
+}
+
+// equal reports whether r and other are the same rule.
+// Description is ignored because it doesn't affect the sampling decisions.
+func (r *Rule) equal(other *Rule) bool {
+	return r.Name == other.Name &&
+		r.Priority == other.Priority &&
+		r.Host == other.Host &&
+		r.HTTPMethod == other.HTTPMethod &&
+		r.URLPath == other.URLPath &&
+		r.ServiceName == other.ServiceName &&
+		r.ServiceType == other.ServiceType &&
+		maps.Equal(r.Attributes, other.Attributes) &&
+		r.FixedTarget == other.FixedTarget &&
+		r.Rate == other.Rate &&
+		r.strict == other.strict &&
+		r.extended == other.extended
 }
 
 // Match returns whether the sampling rule matches against given parameters.
+// The rules of the version 3 match in the same way as the centralized rules.
+// The rules of the version 1 and 2 ignore the parameters that the request doesn't have.
+//
+// The patterns may be wildcards, regular expressions with the "re:" prefix,
+// or path templates with the "tmpl:" prefix in the version 3. e.g. "tmpl:/users/{id}/orders/{orderId}"
 func (r *Rule) Match(req *Request) bool {
 	if req == nil {
 		return true
 	}
-	return (req.Host == "" || WildcardMatchCaseInsensitive(r.Host, req.Host)) &&
-		(req.URL == "" || WildcardMatchCaseInsensitive(r.URLPath, req.URL)) &&
-		(req.Method == "" || WildcardMatchCaseInsensitive(r.HTTPMethod, req.Method))
+	p := r.patterns
+	if p == nil {
+		// the rule is not loaded by the strategies.
+		p = r.cachedPatterns()
+	}
+	if r.strict {
+		return p.host(req.Host) &&
+			p.urlPath(req.URL) &&
+			p.httpMethod(req.Method) &&
+			p.serviceName(req.ServiceName) &&
+			p.serviceType(req.ServiceType) &&
+			p.matchAttributes(req.Attributes)
+	}
+	return (req.Host == "" || p.host(req.Host)) &&
+		(req.URL == "" || p.urlPath(req.URL)) &&
+		(req.Method == "" || p.httpMethod(req.Method))
 }
@@ -0,0 +1,104 @@
+package sampling
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeManifest_Version3(t *testing.T) {
+	m, err := DecodeManifest(strings.NewReader(`{
+		"version": 3,
+		"rules": [
+			{
+				"name": "users",
+				"priority": 10,
+				"service_name": "my-app",
+				"service_type": "AWS::ECS::Container",
+				"url_path": "/users/*",
+				"attributes": {"tenant": "premium-*"},
+				"fixed_target": 1,
+				"rate": 0.5
+			}
+		],
+		"default": {"fixed_target": 1, "rate": 0.05}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := m.Rules[0]
+	if r.Name != "users" || r.Priority != 10 || r.ServiceType != "AWS::ECS::Container" || r.Attributes["tenant"] != "premium-*" {
+		t.Errorf("unexpected rule: %#v", r)
+	}
+}
+
+func TestManifest_Validate_Version3(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest *Manifest
+		wantErr  bool
+	}{
+		{
+			name: "valid",
+			manifest: &Manifest{
+				Version: 3,
+				Rules:   []*Rule{{Name: "foo"}, {Name: "bar"}},
+				Default: &Rule{Name: "fallback"},
+			},
+		},
+		{
+			name: "no name",
+			manifest: &Manifest{
+				Version: 3,
+				Rules:   []*Rule{{URLPath: "/"}},
+				Default: &Rule{},
+			},
+			wantErr: true,
+		},
+		{
+			name: "duplicated name",
+			manifest: &Manifest{
+				Version: 3,
+				Rules:   []*Rule{{Name: "foo"}, {Name: "foo"}},
+				Default: &Rule{},
+			},
+			wantErr: true,
+		},
+		{
+			name: "the same name as the default rule",
+			manifest: &Manifest{
+				Version: 3,
+				Rules:   []*Rule{{Name: DefaultRuleName}},
+				Default: &Rule{},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative priority",
+			manifest: &Manifest{
+				Version: 3,
+				Rules:   []*Rule{{Name: "foo", Priority: -1}},
+				Default: &Rule{},
+			},
+			wantErr: true,
+		},
+		{
+			name: "the default rule with attributes",
+			manifest: &Manifest{
+				Version: 3,
+				Default: &Rule{Attributes: map[string]string{"foo": "bar"}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.manifest.Validate()
+			if tt.wantErr && err == nil {
+				t.Error("want error, got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
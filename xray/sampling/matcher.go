@@ -0,0 +1,205 @@
+package sampling
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	// regexpPrefix is the prefix of the patterns that are regular expressions, e.g. "re:^/users/[0-9]+$".
+	regexpPrefix = "re:"
+
+	// templatePrefix is the prefix of the patterns that are path templates, e.g. "tmpl:/users/{id}".
+	templatePrefix = "tmpl:"
+)
+
+// matcher reports whether the text matches a pattern.
+type matcher func(text string) bool
+
+// compilePattern compiles a pattern of the local sampling rules.
+//
+// If extended is true, the pattern is one of:
+//   - "re:" followed by a regular expression that matches the whole text. e.g. "re:/users/[0-9]+"
+//   - "tmpl:" followed by a path template. e.g. "tmpl:/users/{id}/orders/{orderId}"
+//     "{name}" matches a non-empty path segment, and "{name...}" at the end matches the rest of the path.
+//   - otherwise, a case-insensitive wildcard pattern. e.g. "/users/*"
+//
+// Otherwise, the pattern is always a wildcard pattern, and the prefixes have no special meaning.
+//
+// Unlike the wildcard patterns, the regular expressions and the path templates are case-sensitive.
+// Use the "(?i)" flag for case-insensitive regular expressions.
+func compilePattern(pattern string, extended bool) (matcher, error) {
+	switch {
+	case !extended:
+		return wildcardMatcher(pattern), nil
+	case strings.HasPrefix(pattern, regexpPrefix):
+		re, err := regexp.Compile(`^(?:` + strings.TrimPrefix(pattern, regexpPrefix) + `)$`)
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString, nil
+	case strings.HasPrefix(pattern, templatePrefix):
+		re, err := compileTemplate(strings.TrimPrefix(pattern, templatePrefix))
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString, nil
+	default:
+		return wildcardMatcher(pattern), nil
+	}
+}
+
+func wildcardMatcher(pattern string) matcher {
+	return func(text string) bool {
+		return WildcardMatchCaseInsensitive(pattern, text)
+	}
+}
+
+// matchNothing is the matcher of the invalid patterns.
+func matchNothing(string) bool { return false }
+
+type matcherKey struct {
+	pattern  string
+	extended bool
+}
+
+// matcherCache caches the compiled patterns of the rules that the strategies don't load, e.g. the rules that users make,
+// so that Rule.Match doesn't compile the regular expressions for every request.
+var matcherCache sync.Map // map[matcherKey]matcher
+
+// cachedPattern is same as compilePattern, but it caches the compiled pattern.
+// The invalid pattern matches nothing.
+func cachedPattern(pattern string, extended bool) (matcher, error) {
+	key := matcherKey{pattern: pattern, extended: extended}
+	if m, ok := matcherCache.Load(key); ok {
+		return m.(matcher), nil
+	}
+	m, err := compilePattern(pattern, extended)
+	if err != nil {
+		m = matchNothing
+	}
+	actual, _ := matcherCache.LoadOrStore(key, m)
+	return actual.(matcher), nil
+}
+
+// compileTemplate converts the path template into a regular expression.
+func compileTemplate(tmpl string) (*regexp.Regexp, error) {
+	var buf strings.Builder
+	buf.WriteString("^")
+	rest := tmpl
+	for rest != "" {
+		i := strings.IndexByte(rest, '{')
+		if i < 0 {
+			if strings.IndexByte(rest, '}') >= 0 {
+				return nil, fmt.Errorf("unexpected '}' in the path template %q", tmpl)
+			}
+			buf.WriteString(regexp.QuoteMeta(rest))
+			break
+		}
+		if strings.IndexByte(rest[:i], '}') >= 0 {
+			return nil, fmt.Errorf("unexpected '}' in the path template %q", tmpl)
+		}
+		buf.WriteString(regexp.QuoteMeta(rest[:i]))
+		rest = rest[i+1:]
+
+		j := strings.IndexByte(rest, '}')
+		if j < 0 {
+			return nil, fmt.Errorf("unclosed '{' in the path template %q", tmpl)
+		}
+		name := rest[:j]
+		rest = rest[j+1:]
+		if name, ok := strings.CutSuffix(name, "..."); ok {
+			if !isTemplateName(name) {
+				return nil, fmt.Errorf("invalid wildcard name %q in the path template %q", name, tmpl)
+			}
+			if rest != "" {
+				return nil, fmt.Errorf("{%s...} must be at the end of the path template %q", name, tmpl)
+			}
+			buf.WriteString(".*")
+			break
+		}
+		if !isTemplateName(name) {
+			return nil, fmt.Errorf("invalid wildcard name %q in the path template %q", name, tmpl)
+		}
+		buf.WriteString("[^/]+")
+	}
+	buf.WriteString("$")
+	return regexp.Compile(buf.String())
+}
+
+func isTemplateName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if r != '_' && !('a' <= r && r <= 'z') && !('A' <= r && r <= 'Z') && !('0' <= r && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// rulePatterns are the compiled patterns of a local rule.
+type rulePatterns struct {
+	host        matcher
+	httpMethod  matcher
+	urlPath     matcher
+	serviceName matcher
+	serviceType matcher
+	attributes  map[string]matcher
+}
+
+// compile compiles the patterns of the rule.
+// The "re:" and "tmpl:" prefixes are available if extended is true.
+func (r *Rule) compile(extended bool) (*rulePatterns, error) {
+	return r.compileWith(extended, compilePattern)
+}
+
+// cachedPatterns returns the patterns of the rule that are compiled with cachedPattern.
+func (r *Rule) cachedPatterns() *rulePatterns {
+	p, _ := r.compileWith(r.extended, cachedPattern)
+	return p
+}
+
+func (r *Rule) compileWith(extended bool, compilePattern func(pattern string, extended bool) (matcher, error)) (*rulePatterns, error) {
+	var errs []error
+	compile := func(field, pattern string) matcher {
+		m, err := compilePattern(pattern, extended)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", field, err))
+			// the invalid pattern matches nothing.
+			return matchNothing
+		}
+		return m
+	}
+
+	p := &rulePatterns{
+		host:        compile("host", r.Host),
+		httpMethod:  compile("http_method", r.HTTPMethod),
+		urlPath:     compile("url_path", r.URLPath),
+		serviceName: compile("service_name", r.ServiceName),
+		serviceType: compile("service_type", r.ServiceType),
+	}
+	if len(r.Attributes) > 0 {
+		p.attributes = make(map[string]matcher, len(r.Attributes))
+		for key, pattern := range r.Attributes {
+			p.attributes[key] = compile("attributes."+key, pattern)
+		}
+	}
+	return p, errors.Join(errs...)
+}
+
+// matchAttributes returns whether the attributes match all patterns.
+// The attributes that are not in patterns are ignored.
+func (p *rulePatterns) matchAttributes(attributes map[string]string) bool {
+	for key, match := range p.attributes {
+		value, ok := attributes[key]
+		if !ok || !match(value) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,159 @@
+package sampling
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompilePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		text    string
+		want    bool
+	}{
+		// wildcard
+		{pattern: "/users/*", text: "/USERS/42", want: true},
+		{pattern: "/users/?", text: "/users/42", want: false},
+
+		// regular expression
+		{pattern: "re:/users/[0-9]+", text: "/users/42", want: true},
+		{pattern: "re:/users/[0-9]+", text: "/users/42/orders", want: false},
+		{pattern: "re:/users/[0-9]+", text: "/prefix/users/42", want: false},
+		{pattern: "re:GET|POST", text: "POST", want: true},
+		{pattern: "re:GET|POST", text: "post", want: false},
+		{pattern: "re:(?i)GET|POST", text: "post", want: true},
+
+		// path template
+		{pattern: "tmpl:/users/{id}/orders/{orderId}", text: "/users/42/orders/1", want: true},
+		{pattern: "tmpl:/users/{id}/orders/{orderId}", text: "/users/42/orders/", want: false},
+		{pattern: "tmpl:/users/{id}/orders/{orderId}", text: "/users/42/orders/1/items", want: false},
+		{pattern: "tmpl:/users/{id}", text: "/users/a/b", want: false},
+		{pattern: "tmpl:/files/{path...}", text: "/files/a/b/c.txt", want: true},
+		{pattern: "tmpl:/files/{path...}", text: "/file", want: false},
+		{pattern: "tmpl:/v1.0/{id}", text: "/v1x0/42", want: false},
+		{pattern: "tmpl:/users/{id}.json", text: "/users/42.json", want: true},
+	}
+	for _, tt := range tests {
+		match, err := compilePattern(tt.pattern, true)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.pattern, err)
+			continue
+		}
+		if got := match(tt.text); got != tt.want {
+			t.Errorf("%q, %q: want %t, got %t", tt.pattern, tt.text, tt.want, got)
+		}
+	}
+}
+
+func TestCompilePattern_Invalid(t *testing.T) {
+	tests := []string{
+		"re:/users/(",
+		"tmpl:/users/{id",
+		"tmpl:/users/id}",
+		"tmpl:/users/{}",
+		"tmpl:/users/{user-id}",
+		"tmpl:/files/{path...}/meta",
+	}
+	for _, pattern := range tests {
+		if _, err := compilePattern(pattern, true); err == nil {
+			t.Errorf("%q: want error, got nil", pattern)
+		}
+	}
+}
+
+func TestManifest_Validate_InvalidPattern(t *testing.T) {
+	_, err := DecodeManifest(strings.NewReader(`{
+		"version": 3,
+		"rules": [
+			{"name": "users", "url_path": "re:/users/(", "fixed_target": 1, "rate": 0.5}
+		],
+		"default": {"fixed_target": 1, "rate": 0.05}
+	}`))
+	if err == nil {
+		t.Fatal("want error, got nil")
+	}
+	if !strings.Contains(err.Error(), "users") || !strings.Contains(err.Error(), "url_path") {
+		t.Errorf("want the error to point the rule and the field, got %v", err)
+	}
+}
+
+func TestLocalizedStrategy_PathTemplate(t *testing.T) {
+	s, err := NewLocalizedStrategy(&Manifest{
+		Version: 3,
+		Rules: []*Rule{
+			{
+				Name:        "orders",
+				Host:        "*",
+				HTTPMethod:  "re:GET|HEAD",
+				URLPath:     "tmpl:/users/{id}/orders/{orderId}",
+				ServiceName: "*",
+				FixedTarget: 0,
+				Rate:        1,
+			},
+		},
+		Default: &Rule{
+			FixedTarget: 0,
+			Rate:        0,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		req  *Request
+		want bool
+	}{
+		{req: &Request{Host: "example.com", Method: "GET", URL: "/users/42/orders/1"}, want: true},
+		{req: &Request{Host: "example.com", Method: "POST", URL: "/users/42/orders/1"}, want: false},
+		{req: &Request{Host: "example.com", Method: "GET", URL: "/users/42/orders"}, want: false},
+	}
+	for _, tt := range tests {
+		if got := s.ShouldTrace(tt.req).Sample; got != tt.want {
+			t.Errorf("%v: want %t, got %t", tt.req, tt.want, got)
+		}
+	}
+}
+
+func TestDecodeManifest_Version2Prefix(t *testing.T) {
+	// the "re:" and "tmpl:" prefixes have no special meaning in the version 2.
+	manifest, err := DecodeManifest(strings.NewReader(`{
+		"version": 2,
+		"rules": [
+			{"host": "*", "http_method": "*", "url_path": "re:/users/(", "service_name": "*", "fixed_target": 1, "rate": 0.5}
+		],
+		"default": {"fixed_target": 1, "rate": 0.05}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewLocalizedStrategy(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule := s.manifest.Rules[0]
+	if !rule.Match(&Request{Host: "example.com", Method: "GET", URL: "re:/users/("}) {
+		t.Error("want the literal pattern to match")
+	}
+	if rule.Match(&Request{Host: "example.com", Method: "GET", URL: "/users/("}) {
+		t.Error("want the pattern not to be a regular expression")
+	}
+}
+
+func TestRule_Match_Cache(t *testing.T) {
+	r := &Rule{
+		Host:        "*",
+		HTTPMethod:  "GET",
+		URLPath:     "/cached/*",
+		ServiceName: "*",
+	}
+	req := &Request{Host: "example.com", Method: "GET", URL: "/cached/42"}
+	if !r.Match(req) {
+		t.Fatal("want match")
+	}
+	if _, ok := matcherCache.Load(matcherKey{pattern: "/cached/*", extended: false}); !ok {
+		t.Error("want the pattern to be cached")
+	}
+	if !r.Match(req) {
+		t.Error("want match")
+	}
+}
@@ -40,3 +40,10 @@ func (r *reservoir) Take() bool {
 	r.used++
 	return true
 }
+
+// epoch returns the unix epoch when the reservoir is used last.
+func (r *reservoir) epoch() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.currentEpoch
+}
@@ -0,0 +1,177 @@
+package sampling
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/shogo82148/aws-xray-yasdk-go/xray/xraylog"
+)
+
+// DefaultRuleCacheMaxAge is the default period in which the cached sampling rules are used.
+const DefaultRuleCacheMaxAge = 24 * time.Hour
+
+// ruleCacheVersion is the version of the format of the cache file.
+const ruleCacheVersion = 1
+
+// RuleCacheConfig is the configure of the on-disk cache of the centralized sampling rules.
+type RuleCacheConfig struct {
+	// Path is the path to the cache file.
+	Path string
+
+	// MaxAge is the period in which the cached rules are used after they are fetched.
+	// If it is zero, DefaultRuleCacheMaxAge is used.
+	MaxAge time.Duration
+}
+
+// ruleCacheFile is the content of the cache file.
+type ruleCacheFile struct {
+	Version int             `json:"version"`
+	SavedAt time.Time       `json:"saved_at"`
+	Rules   []*samplingRule `json:"rules"`
+}
+
+type ruleCache struct {
+	path   string
+	maxAge time.Duration
+
+	// returns current time.
+	nowFunc func() time.Time
+}
+
+// EnableRuleCache makes s save the sampling rules to the file whenever it fetches them from X-Ray.
+// The cached rules are loaded immediately, and they are used until the first refresh finishes,
+// so short-lived processes respect the configured rules even if X-Ray is unreachable at startup.
+// The cached rules expire after config.MaxAge, and then the fallback rules are used.
+//
+// A missing, broken or expired cache is not an error. EnableRuleCache should be called before s is used.
+func (s *CentralizedStrategy) EnableRuleCache(config *RuleCacheConfig) error {
+	if config == nil || config.Path == "" {
+		return errors.New("xray/sampling: the path of the rule cache is empty")
+	}
+	maxAge := config.MaxAge
+	if maxAge == 0 {
+		maxAge = DefaultRuleCacheMaxAge
+	}
+	if maxAge < 0 {
+		return errors.New("xray/sampling: the max age of the rule cache must not be negative")
+	}
+	s.cache = &ruleCache{
+		path:   config.Path,
+		maxAge: maxAge,
+	}
+	s.loadCache()
+	return nil
+}
+
+// loadCache loads the cached rules if X-Ray hasn't returned the rules yet.
+func (s *CentralizedStrategy) loadCache() {
+	ctx := context.Background()
+	manifest, err := s.cache.load()
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			xraylog.Debugf(ctx, "xray/sampling: the sampling rule cache %s is not found", s.cache.path)
+		} else {
+			xraylog.Errorf(ctx, "xray/sampling: failed to load the sampling rule cache: %v", err)
+		}
+		return
+	}
+	if manifest == nil {
+		xraylog.Debugf(ctx, "xray/sampling: the sampling rule cache %s is expired", s.cache.path)
+		return
+	}
+
+	s.muRefresh.Lock()
+	defer s.muRefresh.Unlock()
+	if !s.getManifest().RefreshedAt.IsZero() {
+		// the rules are already fetched.
+		return
+	}
+	s.setManifest(manifest)
+	xraylog.Debugf(ctx, "xray/sampling: %d sampling rules are loaded from the cache %s", len(manifest.Rules), s.cache.path)
+}
+
+// load reads the cache file.
+// It returns nil if the cached rules are expired.
+func (c *ruleCache) load() (*centralizedManifest, error) {
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return nil, err
+	}
+	var file ruleCacheFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	if file.Version != ruleCacheVersion {
+		return nil, fmt.Errorf("xray/sampling: unknown version of the rule cache: %d", file.Version)
+	}
+	if len(file.Rules) == 0 {
+		return nil, errors.New("xray/sampling: the rule cache has no rules")
+	}
+
+	expiresAt := file.SavedAt.Add(c.maxAge)
+	if !expiresAt.After(c.now()) {
+		return nil, nil
+	}
+
+	rules := make([]*centralizedRule, 0, len(file.Rules))
+	quotas := make(map[string]*centralizedQuota, len(file.Rules))
+	for _, r := range file.Rules {
+		// we don't have any quota from X-Ray,
+		// so borrow the reservoir quota.
+		quota := &centralizedQuota{
+			fixedRate: r.FixedRate,
+		}
+		rules = append(rules, newCentralizedRule(r, quota))
+		quotas[r.RuleName] = quota
+	}
+	sort.Stable(centralizedRuleSlice(rules))
+	return &centralizedManifest{
+		Rules:       rules,
+		Quotas:      quotas,
+		RefreshedAt: file.SavedAt,
+		ExpiresAt:   expiresAt,
+	}, nil
+}
+
+// save writes the rules to the cache file atomically.
+func (c *ruleCache) save(rules []*samplingRule, now time.Time) error {
+	data, err := json.Marshal(&ruleCacheFile{
+		Version: ruleCacheVersion,
+		SavedAt: now,
+		Rules:   rules,
+	})
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file in the same directory, and rename it.
+	// the processes sharing the cache never read a partially written file.
+	f, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+func (c *ruleCache) now() time.Time {
+	if c.nowFunc != nil {
+		return c.nowFunc()
+	}
+	return time.Now()
+}
@@ -0,0 +1,166 @@
+package sampling
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCentralizedStrategy_RuleCache(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		enc := json.NewEncoder(w)
+		enc.Encode(&getSamplingRulesOutput{
+			SamplingRuleRecords: []*samplingRuleRecord{
+				{
+					SamplingRule: samplingRule{
+						Version:     1,
+						RuleName:    "Default",
+						Priority:    10000,
+						FixedRate:   0.05,
+						HTTPMethod:  "*",
+						Host:        "*",
+						URLPath:     "*",
+						ServiceName: "*",
+						ServiceType: "*",
+						ResourceARN: "*",
+					},
+				},
+				{
+					SamplingRule: samplingRule{
+						Version:     1,
+						RuleName:    "Health",
+						Priority:    1,
+						FixedRate:   0,
+						HTTPMethod:  "GET",
+						Host:        "*",
+						URLPath:     "/health",
+						ServiceName: "*",
+						ServiceType: "*",
+						ResourceARN: "*",
+					},
+				},
+			},
+		})
+	}))
+	addr := strings.TrimPrefix(ts.URL, "http://")
+	path := filepath.Join(t.TempDir(), "rules.json")
+
+	s1, err := NewCentralizedStrategy(addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s1.EnableRuleCache(&RuleCacheConfig{Path: path}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s1.refreshRule(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// the daemon is down.
+	ts.Close()
+
+	s2, err := NewCentralizedStrategy(addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s2.Close()
+	if err := s2.EnableRuleCache(&RuleCacheConfig{Path: path}); err != nil {
+		t.Fatal(err)
+	}
+	manifest := s2.getManifest()
+	if len(manifest.Rules) != 2 {
+		t.Fatalf("want %d rules, got %d", 2, len(manifest.Rules))
+	}
+	if manifest.Rules[0].ruleName != "Health" {
+		t.Errorf("want %q, got %q", "Health", manifest.Rules[0].ruleName)
+	}
+
+	sd := s2.ShouldTrace(&Request{Host: "example.com", Method: "GET", URL: "/health"})
+	if sd.Rule == nil || *sd.Rule != "Health" {
+		t.Errorf("want the cached rule %q, got %v", "Health", sd.Rule)
+	}
+}
+
+func TestCentralizedStrategy_RuleCache_NotFound(t *testing.T) {
+	s, err := NewCentralizedStrategy("127.0.0.1:2000", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.EnableRuleCache(&RuleCacheConfig{Path: filepath.Join(t.TempDir(), "not-found.json")}); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.getManifest().Rules) != 0 {
+		t.Error("want no rules")
+	}
+
+	if err := s.EnableRuleCache(&RuleCacheConfig{}); err == nil {
+		t.Error("want error, got nil")
+	}
+}
+
+func TestRuleCache_Expired(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	c := &ruleCache{
+		path:    path,
+		maxAge:  time.Hour,
+		nowFunc: func() time.Time { return time.Unix(1700003600, 0) },
+	}
+	err := c.save([]*samplingRule{
+		{
+			RuleName:    "Default",
+			Priority:    10000,
+			FixedRate:   0.05,
+			HTTPMethod:  "*",
+			Host:        "*",
+			URLPath:     "*",
+			ServiceName: "*",
+			ServiceType: "*",
+			ResourceARN: "*",
+		},
+	}, time.Unix(1700000000, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err := c.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest != nil {
+		t.Errorf("want the expired cache to be ignored, got %v", manifest)
+	}
+
+	c.nowFunc = func() time.Time { return time.Unix(1700003599, 0) }
+	manifest, err = c.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest == nil {
+		t.Fatal("want the cached rules, got nil")
+	}
+	if want := time.Unix(1700003600, 0); !manifest.ExpiresAt.Equal(want) {
+		t.Errorf("want %s, got %s", want, manifest.ExpiresAt)
+	}
+	if !manifest.isExpired(time.Unix(1700003600, 0)) {
+		t.Error("want expired, but not")
+	}
+}
+
+func TestRuleCache_Broken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	if err := os.WriteFile(path, []byte("{broken"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := &ruleCache{path: path, maxAge: time.Hour}
+	if _, err := c.load(); err == nil {
+		t.Error("want error, got nil")
+	}
+}
@@ -2,9 +2,14 @@
 package sampling
 
 // Decision contains sampling decision and the rule matched for an incoming request.
+// A nil *Decision means that the strategy has no opinion on the request.
 type Decision struct {
 	Sample bool
 	Rule   *string
+
+	// DecidedBy is the name of the component that made the decision.
+	// e.g. "centralized", "localized", "parent", "rate-limit" or "exclusion".
+	DecidedBy string
 }
 
 // Request represents parameters used to make a sampling decision.
@@ -14,11 +19,32 @@ type Request struct {
 	URL         string
 	ServiceName string
 	ServiceType string
+
+	// UserAgent is the user agent of the HTTP request.
+	UserAgent string
+
+	// ResourceARN is the ARN of the AWS resource on which the service runs.
+	ResourceARN string
+
+	// Attributes are arbitrary attributes of the request.
+	// e.g. tenant, route, queue name or user tier.
+	Attributes map[string]string
+
+	// ParentSampled is the sampling decision of the upstream service.
+	// It is nil if the upstream service didn't decide.
+	ParentSampled *bool
+
+	// Error reports whether the request failed with a fault, an error or throttling.
+	// It is known only if the decision is made after the request is processed,
+	// i.e. the strategy is TailSamplingConfig.Strategy of the xray package.
+	// Otherwise, it is always false.
+	Error bool
 }
 
 // Strategy provides an interface for implementing trace sampling strategies.
 type Strategy interface {
 	// ShouldTrace returns a sampling decision for an incoming request.
+	// It may return nil if the strategy has no opinion.
 	ShouldTrace(request *Request) *Decision
 }
 
@@ -0,0 +1,72 @@
+package samplingtest
+
+// The types of the sampling APIs.
+// They are the same as the types in the sampling package.
+
+// https://docs.aws.amazon.com/xray/latest/api/API_GetSamplingRules.html#API_GetSamplingRules_RequestBody
+type getSamplingRulesInput struct {
+	NextToken string `json:"NextToken,omitempty"`
+}
+
+// https://docs.aws.amazon.com/xray/latest/api/API_GetSamplingRules.html#API_GetSamplingRules_ResponseSyntax
+type getSamplingRulesOutput struct {
+	NextToken           string                `json:"NextToken,omitempty"`
+	SamplingRuleRecords []*samplingRuleRecord `json:"SamplingRuleRecords"`
+}
+
+type samplingRuleRecord struct {
+	CreatedAt    float64      `json:"CreatedAt"`
+	ModifiedAt   float64      `json:"ModifiedAt"`
+	SamplingRule samplingRule `json:"SamplingRule"`
+}
+
+type samplingRule struct {
+	Attributes    map[string]string `json:"Attributes"`
+	FixedRate     float64           `json:"FixedRate"`
+	HTTPMethod    string            `json:"HTTPMethod"`
+	Host          string            `json:"Host"`
+	Priority      int64             `json:"Priority"`
+	ReservoirSize int64             `json:"ReservoirSize"`
+	ResourceARN   string            `json:"ResourceARN"`
+	RuleARN       string            `json:"RuleARN"`
+	RuleName      string            `json:"RuleName"`
+	ServiceName   string            `json:"ServiceName"`
+	ServiceType   string            `json:"ServiceType"`
+	URLPath       string            `json:"URLPath"`
+	Version       int64             `json:"Version"`
+}
+
+// https://docs.aws.amazon.com/xray/latest/api/API_GetSamplingTargets.html#API_GetSamplingTargets_RequestBody
+type getSamplingTargetsInput struct {
+	SamplingStatisticsDocuments []*samplingStatisticsDocument `json:"SamplingStatisticsDocuments"`
+}
+
+type samplingStatisticsDocument struct {
+	BorrowCount  int64  `json:"BorrowCount"`
+	ClientID     string `json:"ClientID"`
+	RequestCount int64  `json:"RequestCount"`
+	RuleName     string `json:"RuleName"`
+	SampledCount int64  `json:"SampledCount"`
+	Timestamp    string `json:"Timestamp"`
+}
+
+// https://docs.aws.amazon.com/xray/latest/api/API_GetSamplingTargets.html#API_GetSamplingTargets_ResponseSyntax
+type getSamplingTargetsOutput struct {
+	LastRuleModification    int64                     `json:"LastRuleModification"`
+	SamplingTargetDocuments []*samplingTargetDocument `json:"SamplingTargetDocuments"`
+	UnprocessedStatistics   []*unprocessedStatistics  `json:"UnprocessedStatistics"`
+}
+
+type samplingTargetDocument struct {
+	FixedRate         float64 `json:"FixedRate"`
+	Interval          int64   `json:"Interval"`
+	ReservoirQuota    int64   `json:"ReservoirQuota"`
+	ReservoirQuotaTTL string  `json:"ReservoirQuotaTTL"`
+	RuleName          string  `json:"RuleName"`
+}
+
+type unprocessedStatistics struct {
+	ErrorCode string `json:"ErrorCode"`
+	Message   string `json:"Message"`
+	RuleName  string `json:"RuleName"`
+}
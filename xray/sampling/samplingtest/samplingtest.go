@@ -0,0 +1,366 @@
+// Package samplingtest provides a fake of the centralized sampling service for tests.
+//
+// The fake serves the GetSamplingRules and SamplingTargets APIs in the same way as the X-Ray daemon.
+// It plugs into [github.com/shogo82148/aws-xray-yasdk-go/xray.NewTestDaemon]:
+//
+//	svc := samplingtest.NewService(samplingtest.DefaultRule())
+//	ctx, td := xray.NewTestDaemon(svc)
+//	defer td.Close()
+//
+//	// the client uses the centralized sampling strategy that calls the fake service.
+//	xray.ContextClient(ctx).Reconfigure(&xray.Config{
+//		DaemonAddress: td.DaemonAddress(),
+//	})
+package samplingtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultInterval is the interval in seconds that the fake service asks the clients to report the statistics.
+const DefaultInterval = 10
+
+// Rule is a sampling rule that the fake service serves.
+// The empty patterns are served as "*".
+type Rule struct {
+	RuleName      string
+	Priority      int64
+	FixedRate     float64
+	ReservoirSize int64
+	Host          string
+	HTTPMethod    string
+	URLPath       string
+	ServiceName   string
+	ServiceType   string
+	ResourceARN   string
+	Attributes    map[string]string
+}
+
+// DefaultRule returns the default rule of X-Ray.
+// It samples the first request each second, and five percent of any additional requests.
+func DefaultRule() *Rule {
+	return &Rule{
+		RuleName:      "Default",
+		Priority:      10000,
+		FixedRate:     0.05,
+		ReservoirSize: 1,
+	}
+}
+
+// Target is the sampling target that the fake service returns for a rule.
+type Target struct {
+	// FixedRate is the rate of matching requests to sample after the reservoir is exhausted.
+	FixedRate float64
+
+	// ReservoirQuota is the number of requests per second that the client may sample.
+	ReservoirQuota int64
+
+	// ReservoirQuotaTTL is when the reservoir quota expires.
+	ReservoirQuotaTTL time.Time
+
+	// Interval is the interval in seconds to report the statistics.
+	Interval int64
+}
+
+// StatisticsDocument is the statistics of a rule that a client reports.
+type StatisticsDocument struct {
+	ClientID     string
+	RuleName     string
+	RequestCount int64
+	SampledCount int64
+	BorrowCount  int64
+	Timestamp    time.Time
+}
+
+// Service is a fake of the centralized sampling service.
+// It implements [net/http.Handler].
+type Service struct {
+	mu                   sync.Mutex
+	rules                []*Rule
+	targets              map[string]*Target
+	pageSize             int
+	lastRuleModification time.Time
+	statistics           []*StatisticsDocument
+	clients              map[string]map[string]struct{} // rule name -> client IDs
+	rulesFailures        []int
+	targetsFailures      []int
+	rulesCalls           int
+	targetsCalls         int
+
+	// NowFunc returns the current time. If it is nil, time.Now is used.
+	NowFunc func() time.Time
+}
+
+// NewService returns a new fake service that serves rules.
+func NewService(rules ...*Rule) *Service {
+	s := &Service{
+		targets: make(map[string]*Target),
+		clients: make(map[string]map[string]struct{}),
+	}
+	s.SetRules(rules...)
+	return s
+}
+
+// SetRules replaces the rules.
+// The clients detect the change through the LastRuleModification of the SamplingTargets API.
+// The LastRuleModification is in whole seconds, so it is rounded up to the next second
+// to be after the refresh of the rules in the same second.
+func (s *Service) SetRules(rules ...*Rule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = slices.Clone(rules)
+	s.lastRuleModification = s.nowLocked()
+}
+
+// SetTarget configures the target of the rule.
+// Without the target, the fake service divides the reservoir size of the rule equally among the clients that report it.
+func (s *Service) SetTarget(ruleName string, target *Target) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if target == nil {
+		delete(s.targets, ruleName)
+		return
+	}
+	s.targets[ruleName] = target
+}
+
+// SetPageSize configures the number of the rules in a page of the GetSamplingRules API.
+// Zero means that all rules are returned in a page.
+func (s *Service) SetPageSize(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pageSize = n
+}
+
+// FailGetSamplingRules makes the next calls of the GetSamplingRules API fail with the status code.
+// Each status code is used for one call.
+func (s *Service) FailGetSamplingRules(statusCodes ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rulesFailures = append(s.rulesFailures, statusCodes...)
+}
+
+// FailSamplingTargets makes the next calls of the SamplingTargets API fail with the status code.
+// Each status code is used for one call.
+func (s *Service) FailSamplingTargets(statusCodes ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.targetsFailures = append(s.targetsFailures, statusCodes...)
+}
+
+// Statistics returns the statistics that the clients have reported, in the order of arrival.
+func (s *Service) Statistics() []*StatisticsDocument {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ret := make([]*StatisticsDocument, 0, len(s.statistics))
+	for _, doc := range s.statistics {
+		cp := *doc
+		ret = append(ret, &cp)
+	}
+	return ret
+}
+
+// Calls returns the number of the calls of the GetSamplingRules API and the SamplingTargets API.
+// The failed calls are also counted.
+func (s *Service) Calls() (getSamplingRules, samplingTargets int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rulesCalls, s.targetsCalls
+}
+
+// ServeHTTP implements [net/http.Handler].
+func (s *Service) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	switch req.URL.Path {
+	case "/GetSamplingRules":
+		s.getSamplingRules(w, req)
+	case "/SamplingTargets":
+		s.samplingTargets(w, req)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func (s *Service) getSamplingRules(w http.ResponseWriter, req *http.Request) {
+	var input getSamplingRulesInput
+	if err := json.NewDecoder(req.Body).Decode(&input); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.rulesCalls++
+	if len(s.rulesFailures) > 0 {
+		code := s.rulesFailures[0]
+		s.rulesFailures = s.rulesFailures[1:]
+		s.mu.Unlock()
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+
+	start := 0
+	if input.NextToken != "" {
+		i, err := strconv.Atoi(input.NextToken)
+		if err != nil || i < 0 || i > len(s.rules) {
+			s.mu.Unlock()
+			http.Error(w, "invalid NextToken", http.StatusBadRequest)
+			return
+		}
+		start = i
+	}
+	end := len(s.rules)
+	if s.pageSize > 0 {
+		end = min(start+s.pageSize, end)
+	}
+	var output getSamplingRulesOutput
+	for _, r := range s.rules[start:end] {
+		output.SamplingRuleRecords = append(output.SamplingRuleRecords, &samplingRuleRecord{
+			SamplingRule: samplingRule{
+				RuleName:      r.RuleName,
+				RuleARN:       "arn:aws:xray:us-east-1:123456789012:sampling-rule/" + r.RuleName,
+				Priority:      r.Priority,
+				FixedRate:     r.FixedRate,
+				ReservoirSize: r.ReservoirSize,
+				Host:          wildcardIfEmpty(r.Host),
+				HTTPMethod:    wildcardIfEmpty(r.HTTPMethod),
+				URLPath:       wildcardIfEmpty(r.URLPath),
+				ServiceName:   wildcardIfEmpty(r.ServiceName),
+				ServiceType:   wildcardIfEmpty(r.ServiceType),
+				ResourceARN:   wildcardIfEmpty(r.ResourceARN),
+				Attributes:    r.Attributes,
+				Version:       1,
+			},
+		})
+	}
+	if end < len(s.rules) {
+		output.NextToken = strconv.Itoa(end)
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, &output)
+}
+
+func (s *Service) samplingTargets(w http.ResponseWriter, req *http.Request) {
+	var input getSamplingTargetsInput
+	if err := json.NewDecoder(req.Body).Decode(&input); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.targetsCalls++
+	if len(s.targetsFailures) > 0 {
+		code := s.targetsFailures[0]
+		s.targetsFailures = s.targetsFailures[1:]
+		s.mu.Unlock()
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+
+	now := s.nowLocked()
+	output := getSamplingTargetsOutput{
+		LastRuleModification:    ceilSecond(s.lastRuleModification).Unix(),
+		SamplingTargetDocuments: []*samplingTargetDocument{},
+		UnprocessedStatistics:   []*unprocessedStatistics{},
+	}
+	for _, doc := range input.SamplingStatisticsDocuments {
+		timestamp, _ := time.Parse(time.RFC3339, doc.Timestamp)
+		s.statistics = append(s.statistics, &StatisticsDocument{
+			ClientID:     doc.ClientID,
+			RuleName:     doc.RuleName,
+			RequestCount: doc.RequestCount,
+			SampledCount: doc.SampledCount,
+			BorrowCount:  doc.BorrowCount,
+			Timestamp:    timestamp,
+		})
+
+		rule := s.findRuleLocked(doc.RuleName)
+		if rule == nil {
+			output.UnprocessedStatistics = append(output.UnprocessedStatistics, &unprocessedStatistics{
+				RuleName:  doc.RuleName,
+				ErrorCode: "400",
+				Message:   fmt.Sprintf("the sampling rule %s is not found", doc.RuleName),
+			})
+			continue
+		}
+		clients, ok := s.clients[doc.RuleName]
+		if !ok {
+			clients = make(map[string]struct{})
+			s.clients[doc.RuleName] = clients
+		}
+		clients[doc.ClientID] = struct{}{}
+
+		target, ok := s.targets[doc.RuleName]
+		if !ok {
+			target = &Target{
+				FixedRate:         rule.FixedRate,
+				ReservoirQuota:    rule.ReservoirSize / int64(len(clients)),
+				ReservoirQuotaTTL: now.Add(DefaultInterval * time.Second),
+				Interval:          DefaultInterval,
+			}
+		}
+		output.SamplingTargetDocuments = append(output.SamplingTargetDocuments, &samplingTargetDocument{
+			RuleName:          doc.RuleName,
+			FixedRate:         target.FixedRate,
+			ReservoirQuota:    target.ReservoirQuota,
+			ReservoirQuotaTTL: target.ReservoirQuotaTTL.UTC().Format(time.RFC3339Nano),
+			Interval:          target.Interval,
+		})
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, &output)
+}
+
+func (s *Service) findRuleLocked(name string) *Rule {
+	for _, r := range s.rules {
+		if r.RuleName == name {
+			return r
+		}
+	}
+	return nil
+}
+
+// returns current time. s.mu should be locked.
+func (s *Service) nowLocked() time.Time {
+	if s.NowFunc != nil {
+		return s.NowFunc()
+	}
+	return time.Now()
+}
+
+// ceilSecond rounds t up to the next second.
+func ceilSecond(t time.Time) time.Time {
+	u := t.Truncate(time.Second)
+	if u.Before(t) {
+		u = u.Add(time.Second)
+	}
+	return u
+}
+
+func wildcardIfEmpty(pattern string) string {
+	if pattern == "" {
+		return "*"
+	}
+	return pattern
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
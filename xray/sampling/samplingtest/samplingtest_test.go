@@ -0,0 +1,238 @@
+package samplingtest_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/shogo82148/aws-xray-yasdk-go/xray"
+	"github.com/shogo82148/aws-xray-yasdk-go/xray/sampling/samplingtest"
+)
+
+func post(t *testing.T, url string, input any, output any) int {
+	t.Helper()
+	data, err := json.Marshal(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode
+	}
+	if err := json.NewDecoder(resp.Body).Decode(output); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode
+}
+
+func TestService_Pagination(t *testing.T) {
+	svc := samplingtest.NewService(
+		&samplingtest.Rule{RuleName: "A", Priority: 1},
+		&samplingtest.Rule{RuleName: "B", Priority: 2},
+		samplingtest.DefaultRule(),
+	)
+	svc.SetPageSize(2)
+	ts := httptest.NewServer(svc)
+	defer ts.Close()
+
+	var names []string
+	var token string
+	for {
+		var output struct {
+			NextToken           string
+			SamplingRuleRecords []struct {
+				SamplingRule struct {
+					RuleName string
+					Host     string
+				}
+			}
+		}
+		if code := post(t, ts.URL+"/GetSamplingRules", map[string]string{"NextToken": token}, &output); code != http.StatusOK {
+			t.Fatalf("unexpected status code: %d", code)
+		}
+		for _, r := range output.SamplingRuleRecords {
+			names = append(names, r.SamplingRule.RuleName)
+			if r.SamplingRule.Host != "*" {
+				t.Errorf("want %q, got %q", "*", r.SamplingRule.Host)
+			}
+		}
+		if output.NextToken == "" {
+			break
+		}
+		token = output.NextToken
+	}
+	if diff := cmp.Diff([]string{"A", "B", "Default"}, names); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	if rules, _ := svc.Calls(); rules != 2 {
+		t.Errorf("want %d, got %d", 2, rules)
+	}
+}
+
+func TestService_SamplingTargets(t *testing.T) {
+	now := time.Date(2001, time.September, 9, 1, 46, 40, 0, time.UTC)
+	svc := samplingtest.NewService(&samplingtest.Rule{
+		RuleName:      "Shared",
+		FixedRate:     0.1,
+		ReservoirSize: 10,
+	})
+	svc.NowFunc = func() time.Time { return now }
+	ts := httptest.NewServer(svc)
+	defer ts.Close()
+
+	type output struct {
+		SamplingTargetDocuments []struct {
+			RuleName          string
+			ReservoirQuota    int64
+			ReservoirQuotaTTL string
+		}
+		UnprocessedStatistics []struct {
+			RuleName string
+		}
+	}
+	report := func(clientID, ruleName string) output {
+		var out output
+		input := map[string]any{
+			"SamplingStatisticsDocuments": []map[string]any{
+				{
+					"ClientID":     clientID,
+					"RuleName":     ruleName,
+					"RequestCount": 3,
+					"SampledCount": 2,
+					"BorrowCount":  1,
+					"Timestamp":    now.Format(time.RFC3339),
+				},
+			},
+		}
+		if code := post(t, ts.URL+"/SamplingTargets", input, &out); code != http.StatusOK {
+			t.Fatalf("unexpected status code: %d", code)
+		}
+		return out
+	}
+
+	// the reservoir is divided among the clients.
+	if got := report("client-1", "Shared").SamplingTargetDocuments[0].ReservoirQuota; got != 10 {
+		t.Errorf("want %d, got %d", 10, got)
+	}
+	out := report("client-2", "Shared")
+	if got := out.SamplingTargetDocuments[0].ReservoirQuota; got != 5 {
+		t.Errorf("want %d, got %d", 5, got)
+	}
+	if got := out.SamplingTargetDocuments[0].ReservoirQuotaTTL; got != "2001-09-09T01:46:50Z" {
+		t.Errorf("want %q, got %q", "2001-09-09T01:46:50Z", got)
+	}
+
+	// the configured target wins.
+	svc.SetTarget("Shared", &samplingtest.Target{ReservoirQuota: 42, ReservoirQuotaTTL: now})
+	if got := report("client-1", "Shared").SamplingTargetDocuments[0].ReservoirQuota; got != 42 {
+		t.Errorf("want %d, got %d", 42, got)
+	}
+
+	// unknown rules are unprocessed.
+	if got := report("client-1", "Unknown").UnprocessedStatistics; len(got) != 1 || got[0].RuleName != "Unknown" {
+		t.Errorf("unexpected unprocessed statistics: %v", got)
+	}
+
+	stats := svc.Statistics()
+	if len(stats) != 4 {
+		t.Fatalf("want %d, got %d", 4, len(stats))
+	}
+	want := &samplingtest.StatisticsDocument{
+		ClientID:     "client-2",
+		RuleName:     "Shared",
+		RequestCount: 3,
+		SampledCount: 2,
+		BorrowCount:  1,
+		Timestamp:    now,
+	}
+	if diff := cmp.Diff(want, stats[1]); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestService_LastRuleModification(t *testing.T) {
+	now := time.Date(2001, time.September, 9, 1, 46, 40, 100_000_000, time.UTC)
+	svc := samplingtest.NewService()
+	svc.NowFunc = func() time.Time { return now }
+	ts := httptest.NewServer(svc)
+	defer ts.Close()
+
+	// the client refreshes the rules, and then the rules change in the same second.
+	refreshedAt := now
+	now = now.Add(500 * time.Millisecond)
+	svc.SetRules(samplingtest.DefaultRule())
+
+	var output struct {
+		LastRuleModification int64
+	}
+	input := map[string]any{"SamplingStatisticsDocuments": []any{}}
+	if code := post(t, ts.URL+"/SamplingTargets", input, &output); code != http.StatusOK {
+		t.Fatalf("unexpected status code: %d", code)
+	}
+	if got := time.Unix(output.LastRuleModification, 0); !got.After(refreshedAt) {
+		t.Errorf("want LastRuleModification after %s, got %s", refreshedAt, got)
+	}
+}
+
+func TestService_Fail(t *testing.T) {
+	svc := samplingtest.NewService(samplingtest.DefaultRule())
+	svc.FailGetSamplingRules(http.StatusInternalServerError)
+	svc.FailSamplingTargets(http.StatusTooManyRequests)
+	ts := httptest.NewServer(svc)
+	defer ts.Close()
+
+	var out map[string]any
+	if code := post(t, ts.URL+"/GetSamplingRules", map[string]any{}, &out); code != http.StatusInternalServerError {
+		t.Errorf("want %d, got %d", http.StatusInternalServerError, code)
+	}
+	if code := post(t, ts.URL+"/GetSamplingRules", map[string]any{}, &out); code != http.StatusOK {
+		t.Errorf("want %d, got %d", http.StatusOK, code)
+	}
+	if code := post(t, ts.URL+"/SamplingTargets", map[string]any{}, &out); code != http.StatusTooManyRequests {
+		t.Errorf("want %d, got %d", http.StatusTooManyRequests, code)
+	}
+}
+
+func TestService_TestDaemon(t *testing.T) {
+	svc := samplingtest.NewService(
+		&samplingtest.Rule{RuleName: "Always", Priority: 1, FixedRate: 1, ServiceName: "my-service"},
+		samplingtest.DefaultRule(),
+	)
+	ctx, td := xray.NewTestDaemon(svc)
+	defer td.Close()
+	if err := xray.ContextClient(ctx).Reconfigure(&xray.Config{
+		DaemonAddress: td.DaemonAddress(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the rules are fetched in background.
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		_, seg := xray.BeginSegment(ctx, "my-service")
+		if seg == nil {
+			// not sampled by the fallback rule.
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+		seg.Close()
+		got, err := td.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, _ := got.AWS.Get("xray").(map[string]any)
+		if name, _ := info["sampling_rule_name"].(string); name == "Always" {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("the rule of the fake service is not used")
+}
@@ -0,0 +1,155 @@
+package sampling
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// SimulatedRule is a sampling rule in a Simulator.
+type SimulatedRule struct {
+	// Name identifies the rule.
+	// It is the rule name, or the description or the position of the local rules without names.
+	// The default local rule without a name is named "default".
+	Name string
+
+	// Reservoir is the number of requests per second that are sampled before applying Rate.
+	// For the centralized rules, it is the reservoir size that all services using the rule share.
+	Reservoir int64
+
+	// Rate is the rate of matching requests to sample after the reservoir is exhausted.
+	Rate float64
+}
+
+// ExpectedSampled returns the expected number of sampled requests per second,
+// when requestsPerSecond requests per second match the rule.
+func (r *SimulatedRule) ExpectedSampled(requestsPerSecond float64) float64 {
+	reservoir := min(requestsPerSecond, float64(r.Reservoir))
+	return reservoir + (requestsPerSecond-reservoir)*r.Rate
+}
+
+// Simulator finds the rules that match requests without sampling them.
+// It helps to review the changes of the sampling rules.
+type Simulator struct {
+	rules     []*SimulatedRule
+	matches   []func(req *Request) bool
+	exclusion *Exclusion
+}
+
+// NewManifestSimulator returns a Simulator for the local manifest.
+// It excludes no requests by default, as LocalizedStrategy does.
+func NewManifestSimulator(manifest *Manifest) (*Simulator, error) {
+	if err := manifest.Validate(); err != nil {
+		return nil, err
+	}
+	cp := manifest.Copy()
+	cp.normalize()
+
+	s := &Simulator{}
+	for i, r := range cp.Rules {
+		name := r.Name
+		if name == "" {
+			name = r.Description
+		}
+		if name == "" {
+			name = "#" + strconv.Itoa(i+1)
+		}
+		s.rules = append(s.rules, &SimulatedRule{
+			Name:      name,
+			Reservoir: r.FixedTarget,
+			Rate:      r.Rate,
+		})
+		s.matches = append(s.matches, r.Match)
+	}
+	defaultName := cp.Default.Name
+	if defaultName == "" {
+		defaultName = "default"
+	}
+	s.rules = append(s.rules, &SimulatedRule{
+		Name:      defaultName,
+		Reservoir: cp.Default.FixedTarget,
+		Rate:      cp.Default.Rate,
+	})
+	s.matches = append(s.matches, func(req *Request) bool { return true })
+	return s, nil
+}
+
+// centralizedRulesDump is the json-encoded output of the GetSamplingRules API.
+// The API returns CreatedAt and ModifiedAt as epoch seconds, but the AWS CLI writes them as ISO 8601 strings.
+// The simulator doesn't need them, so they are not decoded.
+type centralizedRulesDump struct {
+	SamplingRuleRecords []struct {
+		SamplingRule samplingRule `json:"SamplingRule"`
+	} `json:"SamplingRuleRecords"`
+}
+
+// DecodeCentralizedRules decodes the json-encoded output of the GetSamplingRules API,
+// e.g. the output of `aws xray get-sampling-rules`, and returns a Simulator for the rules.
+// It excludes the requests in DefaultExclusion by default, as CentralizedStrategy does.
+func DecodeCentralizedRules(r io.Reader) (*Simulator, error) {
+	var output centralizedRulesDump
+	dec := json.NewDecoder(r)
+	if err := dec.Decode(&output); err != nil {
+		return nil, err
+	}
+	if len(output.SamplingRuleRecords) == 0 {
+		return nil, errors.New("xray/sampling: no sampling rules found")
+	}
+
+	rules := make([]*centralizedRule, 0, len(output.SamplingRuleRecords))
+	reservoirs := make(map[string]int64, len(output.SamplingRuleRecords))
+	for _, record := range output.SamplingRuleRecords {
+		r := record.SamplingRule
+		rules = append(rules, newCentralizedRule(&r, &centralizedQuota{
+			fixedRate: r.FixedRate,
+		}))
+		reservoirs[r.RuleName] = r.ReservoirSize
+	}
+	sort.Stable(centralizedRuleSlice(rules))
+
+	s := &Simulator{
+		exclusion: DefaultExclusion,
+	}
+	for _, r := range rules {
+		s.rules = append(s.rules, &SimulatedRule{
+			Name:      r.ruleName,
+			Reservoir: reservoirs[r.ruleName],
+			Rate:      r.quota.fixedRate,
+		})
+		s.matches = append(s.matches, r.Match)
+	}
+	return s, nil
+}
+
+// Rules returns the rules in the order of matching.
+func (s *Simulator) Rules() []*SimulatedRule {
+	return s.rules
+}
+
+// SetExclusion configures the requests that are never sampled.
+// A nil e excludes no requests.
+func (s *Simulator) SetExclusion(e *Exclusion) {
+	s.exclusion = e
+}
+
+// Excluded returns why req is never sampled.
+// It returns an empty string if req is not excluded.
+func (s *Simulator) Excluded(req *Request) string {
+	return s.exclusion.reason(req)
+}
+
+// Match returns the first rule that matches req.
+// It returns nil if req is excluded or no rule matches.
+func (s *Simulator) Match(req *Request) *SimulatedRule {
+	if s.Excluded(req) != "" {
+		return nil
+	}
+	for i, match := range s.matches {
+		if match(req) {
+			return s.rules[i]
+		}
+	}
+	return nil
+}
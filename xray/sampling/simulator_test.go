@@ -0,0 +1,118 @@
+package sampling
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestManifestSimulator(t *testing.T) {
+	s, err := NewManifestSimulator(&Manifest{
+		Version: 2,
+		Rules: []*Rule{
+			{
+				Description: "health check",
+				Host:        "*",
+				URLPath:     "/health",
+				HTTPMethod:  "GET",
+				ServiceName: "*",
+				FixedTarget: 0,
+				Rate:        0,
+			},
+			{
+				Host:        "api.example.com",
+				URLPath:     "*",
+				HTTPMethod:  "*",
+				ServiceName: "*",
+				FixedTarget: 2,
+				Rate:        0.5,
+			},
+		},
+		Default: &Rule{
+			FixedTarget: 1,
+			Rate:        0.05,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		req  *Request
+		want string
+	}{
+		{req: &Request{Host: "example.com", Method: "GET", URL: "/health"}, want: "health check"},
+		{req: &Request{Host: "api.example.com", Method: "POST", URL: "/users"}, want: "#2"},
+		{req: &Request{Host: "example.com", Method: "GET", URL: "/"}, want: "default"},
+	}
+	for _, tt := range tests {
+		if got := s.Match(tt.req).Name; got != tt.want {
+			t.Errorf("%v: want %q, got %q", tt.req, tt.want, got)
+		}
+	}
+
+	rule := s.Rules()[1]
+	// 2 requests from the reservoir, and half of the rest.
+	if got := rule.ExpectedSampled(10); math.Abs(got-6) > 1e-9 {
+		t.Errorf("want %f, got %f", 6.0, got)
+	}
+	if got := rule.ExpectedSampled(1); math.Abs(got-1) > 1e-9 {
+		t.Errorf("want %f, got %f", 1.0, got)
+	}
+}
+
+func TestDecodeCentralizedRules(t *testing.T) {
+	s, err := DecodeCentralizedRules(strings.NewReader(`{
+		"SamplingRuleRecords": [
+			{
+				"SamplingRule": {
+					"RuleName": "Default", "Priority": 10000, "FixedRate": 0.05, "ReservoirSize": 1,
+					"Host": "*", "HTTPMethod": "*", "URLPath": "*", "ServiceName": "*", "ServiceType": "*", "ResourceARN": "*"
+				}
+			},
+			{
+				"SamplingRule": {
+					"RuleName": "Users", "Priority": 1, "FixedRate": 0.1, "ReservoirSize": 5,
+					"Host": "*", "HTTPMethod": "GET", "URLPath": "/users/*", "ServiceName": "my-*", "ServiceType": "*", "ResourceARN": "*"
+				}
+			}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, r := range s.Rules() {
+		names = append(names, r.Name)
+	}
+	if strings.Join(names, ",") != "Users,Default" {
+		t.Errorf("unexpected order: %v", names)
+	}
+
+	got := s.Match(&Request{Host: "example.com", Method: "GET", URL: "/users/42", ServiceName: "my-app"})
+	if got.Name != "Users" || got.Reservoir != 5 || got.Rate != 0.1 {
+		t.Errorf("unexpected rule: %#v", got)
+	}
+	got = s.Match(&Request{Host: "example.com", Method: "GET", URL: "/users/42", ServiceName: "other"})
+	if got.Name != "Default" {
+		t.Errorf("unexpected rule: %#v", got)
+	}
+
+	// the direct IP access is excluded as CentralizedStrategy does.
+	req := &Request{Host: "10.0.0.1:8080", Method: "GET", URL: "/users/42", ServiceName: "my-app"}
+	if got := s.Excluded(req); got != "direct IP access" {
+		t.Errorf("want %q, got %q", "direct IP access", got)
+	}
+	if got := s.Match(req); got != nil {
+		t.Errorf("want nil, got %#v", got)
+	}
+	s.SetExclusion(nil)
+	if got := s.Match(req); got == nil || got.Name != "Users" {
+		t.Errorf("unexpected rule: %#v", got)
+	}
+
+	if _, err := DecodeCentralizedRules(strings.NewReader(`{}`)); err == nil {
+		t.Error("want error, got nil")
+	}
+}
@@ -0,0 +1,162 @@
+package sampling
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"time"
+)
+
+// Snapshot is the state of a sampling strategy at a point in time.
+// It helps operators to see why a request was or wasn't sampled.
+type Snapshot struct {
+	// Strategy is the kind of the strategy, e.g. "centralized", "localized" or "file".
+	Strategy string `json:"strategy"`
+
+	// RefreshedAt is the time when the rules are loaded last.
+	// It is zero if the rules are not loaded yet.
+	RefreshedAt time.Time `json:"refreshed_at,omitzero"`
+
+	// Rules are the rules in the order of matching.
+	Rules []*RuleSnapshot `json:"rules"`
+
+	// Default is the default rule of the local manifest.
+	// The default rule of the centralized sampling is included in Rules.
+	Default *RuleSnapshot `json:"default,omitempty"`
+
+	// Excluded is the number of the requests that are excluded from sampling.
+	Excluded int64 `json:"excluded,omitempty"`
+
+	// Fallback is the snapshot of the strategy used when the centralized rules are not available.
+	Fallback *Snapshot `json:"fallback,omitempty"`
+}
+
+// RuleSnapshot is the state of a sampling rule.
+type RuleSnapshot struct {
+	// Name is the name of the rule.
+	Name string `json:"name,omitempty"`
+
+	// Description is the description of the local rule.
+	Description string `json:"description,omitempty"`
+
+	// Priority is the priority of the rule.
+	Priority int64 `json:"priority,omitempty"`
+
+	// The parameters to match against requests.
+	Host        string            `json:"host,omitempty"`
+	HTTPMethod  string            `json:"http_method,omitempty"`
+	URLPath     string            `json:"url_path,omitempty"`
+	ServiceName string            `json:"service_name,omitempty"`
+	ServiceType string            `json:"service_type,omitempty"`
+	ResourceARN string            `json:"resource_arn,omitempty"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+
+	// FixedTarget is the reservoir size of the local rule.
+	FixedTarget int64 `json:"fixed_target,omitempty"`
+
+	// FixedRate is the rate of matching requests to sample after the reservoir is exhausted.
+	FixedRate float64 `json:"fixed_rate"`
+
+	// ReservoirQuota is the number of requests per second that X-Ray allocated this service.
+	ReservoirQuota int64 `json:"reservoir_quota,omitempty"`
+
+	// ReservoirQuotaTTL is when the reservoir quota expires.
+	// It is zero if X-Ray has not allocated any quota yet, and then one request per second is borrowed.
+	ReservoirQuotaTTL time.Time `json:"reservoir_quota_ttl,omitzero"`
+
+	// Interval is the interval to report the statistics in seconds, as X-Ray specifies.
+	Interval int64 `json:"interval,omitempty"`
+
+	// The statistics since the rule is loaded.
+	Requests int64 `json:"requests"`
+	Sampled  int64 `json:"sampled"`
+	Borrowed int64 `json:"borrowed,omitempty"`
+}
+
+// Snapshotter is a strategy that provides its snapshot.
+type Snapshotter interface {
+	Snapshot() *Snapshot
+}
+
+var _ Snapshotter = (*CentralizedStrategy)(nil)
+var _ Snapshotter = (*LocalizedStrategy)(nil)
+var _ Snapshotter = (*FileStrategy)(nil)
+
+// Snapshot returns the current rules and their statistics.
+func (s *LocalizedStrategy) Snapshot() *Snapshot {
+	rules := make([]*RuleSnapshot, 0, len(s.manifest.Rules))
+	for i, r := range s.manifest.Rules {
+		rules = append(rules, localRuleSnapshot(r, s.counters[i]))
+	}
+	return &Snapshot{
+		Strategy: "localized",
+		Excluded: s.exclusion.excluded.Load(),
+		Rules:    rules,
+		Default:  localRuleSnapshot(s.manifest.Default, s.defaultCounter),
+	}
+}
+
+func localRuleSnapshot(r *Rule, c *ruleCounter) *RuleSnapshot {
+	return &RuleSnapshot{
+		Name:        r.Name,
+		Description: r.Description,
+		Priority:    r.Priority,
+		Host:        r.Host,
+		HTTPMethod:  r.HTTPMethod,
+		URLPath:     r.URLPath,
+		ServiceName: r.ServiceName,
+		ServiceType: r.ServiceType,
+		Attributes:  maps.Clone(r.Attributes),
+		FixedTarget: r.FixedTarget,
+		FixedRate:   r.Rate,
+		Requests:    c.requests.Load(),
+		Sampled:     c.sampled.Load(),
+	}
+}
+
+// Snapshot returns the current rules, quotas and their statistics.
+func (s *CentralizedStrategy) Snapshot() *Snapshot {
+	manifest := s.getManifest()
+	rules := make([]*RuleSnapshot, 0, len(manifest.Rules))
+	for _, r := range manifest.Rules {
+		rule := &RuleSnapshot{
+			Name:        r.ruleName,
+			Priority:    r.priority,
+			Host:        r.host,
+			HTTPMethod:  r.httpMethod,
+			URLPath:     r.urlPath,
+			ServiceName: r.serviceName,
+			ServiceType: r.serviceType,
+			ResourceARN: r.resourceARN,
+			Attributes:  maps.Clone(r.attributes),
+		}
+		r.quota.snapshot(rule)
+		rules = append(rules, rule)
+	}
+	return &Snapshot{
+		Strategy:    "centralized",
+		RefreshedAt: manifest.RefreshedAt,
+		Excluded:    s.exclusion.excluded.Load(),
+		Rules:       rules,
+		Fallback:    s.fallback.Snapshot(),
+	}
+}
+
+// NewSnapshotHandler returns an http.Handler that renders the snapshot of s in JSON.
+func NewSnapshotHandler(s Snapshotter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		data, err := json.MarshalIndent(s.Snapshot(), "", "  ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(data)
+	})
+}
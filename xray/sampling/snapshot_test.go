@@ -0,0 +1,180 @@
+package sampling
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLocalizedStrategy_Snapshot(t *testing.T) {
+	s, err := NewLocalizedStrategy(&Manifest{
+		Version: 2,
+		Rules: []*Rule{
+			{
+				Description: "health check",
+				Host:        "*",
+				URLPath:     "/health",
+				HTTPMethod:  "*",
+				ServiceName: "*",
+				FixedTarget: 0,
+				Rate:        0,
+			},
+		},
+		Default: &Rule{
+			FixedTarget: 1,
+			Rate:        0,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.ShouldTrace(&Request{Host: "example.com", URL: "/health", Method: "GET"})
+	s.ShouldTrace(&Request{Host: "example.com", URL: "/", Method: "GET"})
+
+	want := &Snapshot{
+		Strategy: "localized",
+		Rules: []*RuleSnapshot{
+			{
+				Description: "health check",
+				Host:        "*",
+				HTTPMethod:  "*",
+				URLPath:     "/health",
+				ServiceName: "*",
+				Requests:    1,
+				Sampled:     0,
+			},
+		},
+		Default: &RuleSnapshot{
+			FixedTarget: 1,
+			Requests:    1,
+			Sampled:     1,
+		},
+	}
+	if diff := cmp.Diff(want, s.Snapshot()); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestCentralizedStrategy_Snapshot(t *testing.T) {
+	s, err := NewCentralizedStrategy("127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	refreshedAt := time.Unix(1000000000, 0)
+	ttl := refreshedAt.Add(time.Minute)
+	quota := &centralizedQuota{
+		fixedRate:        0.1,
+		quota:            10,
+		ttl:              ttl,
+		interval:         10 * time.Second,
+		requests:         3,
+		sampled:          2,
+		reportedRequests: 10,
+		reportedSampled:  5,
+		reportedBorrowed: 1,
+	}
+	s.manifest = &centralizedManifest{
+		Rules: []*centralizedRule{
+			{
+				quota:       quota,
+				ruleName:    "Default",
+				priority:    10000,
+				host:        "*",
+				urlPath:     "*",
+				httpMethod:  "*",
+				serviceName: "*",
+				serviceType: "*",
+				resourceARN: "*",
+			},
+		},
+		Quotas: map[string]*centralizedQuota{
+			"Default": quota,
+		},
+		RefreshedAt: refreshedAt,
+	}
+
+	got := s.Snapshot()
+	want := &Snapshot{
+		Strategy:    "centralized",
+		RefreshedAt: refreshedAt,
+		Rules: []*RuleSnapshot{
+			{
+				Name:              "Default",
+				Priority:          10000,
+				Host:              "*",
+				HTTPMethod:        "*",
+				URLPath:           "*",
+				ServiceName:       "*",
+				ServiceType:       "*",
+				ResourceARN:       "*",
+				FixedRate:         0.1,
+				ReservoirQuota:    10,
+				ReservoirQuotaTTL: ttl,
+				Interval:          10,
+				Requests:          13,
+				Sampled:           7,
+				Borrowed:          1,
+			},
+		},
+		Fallback: &Snapshot{
+			Strategy: "localized",
+			Rules:    []*RuleSnapshot{},
+			Default: &RuleSnapshot{
+				FixedTarget: 1,
+				FixedRate:   0.05,
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	// reporting the statistics doesn't change the snapshot.
+	quota.Stats()
+	if got := s.Snapshot().Rules[0].Requests; got != 13 {
+		t.Errorf("want %d, got %d", 13, got)
+	}
+}
+
+func TestSnapshotHandler(t *testing.T) {
+	s, err := NewLocalizedStrategy(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(NewSnapshotHandler(s))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status: %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("unexpected Content-Type: %s", got)
+	}
+	var got Snapshot
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(s.Snapshot(), &got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	resp, err = http.Post(ts.URL, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,125 @@
+package sampling
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/shogo82148/aws-xray-yasdk-go/internal/sigv4"
+)
+
+// XRayAPIConfig is the configure for calling the AWS X-Ray API directly, without the X-Ray daemon.
+type XRayAPIConfig struct {
+	// Region is the region of the AWS X-Ray API.
+	// If it is empty, the value of AWS_REGION or AWS_DEFAULT_REGION environment value is used.
+	Region string
+
+	// Endpoint is the base URL of the AWS X-Ray API.
+	// If it is empty, https://xray.<region>.amazonaws.com is used.
+	Endpoint string
+
+	// Credentials provides the credentials for signing the requests.
+	// If it is nil, the credentials are retrieved from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment values,
+	// or from the container credential endpoint that AWS_CONTAINER_CREDENTIALS_RELATIVE_URI or AWS_CONTAINER_CREDENTIALS_FULL_URI points to.
+	Credentials CredentialsProvider
+}
+
+// Credentials is AWS credentials.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// CredentialsProvider provides AWS credentials.
+type CredentialsProvider interface {
+	Retrieve(ctx context.Context) (Credentials, error)
+}
+
+// NewCentralizedStrategyWithXRayAPI returns new centralized sampling strategy that calls the AWS X-Ray API directly.
+// The requests are signed with AWS Signature Version 4.
+// If local rule is nil, the DefaultSamplingRule is used for the fallback.
+func NewCentralizedStrategyWithXRayAPI(config *XRayAPIConfig, manifest *Manifest) (*CentralizedStrategy, error) {
+	if config == nil {
+		config = &XRayAPIConfig{}
+	}
+	region := config.Region
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		return nil, errors.New("xray/sampling: the region of AWS X-Ray API is not specified")
+	}
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = "https://xray." + region + ".amazonaws.com"
+		if strings.HasPrefix(region, "cn-") {
+			endpoint += ".cn"
+		}
+	}
+
+	s, err := NewCentralizedStrategy("", manifest)
+	if err != nil {
+		return nil, err
+	}
+	s.endpoint = strings.TrimSuffix(endpoint, "/")
+
+	// unlike the X-Ray daemon, AWS X-Ray API may be accessed through the proxy.
+	transport := s.httpClient.Transport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	s.httpClient.Transport = transport
+
+	var provider sigv4.Provider
+	if config.Credentials != nil {
+		provider = sigv4.ProviderFunc(func(ctx context.Context) (sigv4.Credentials, error) {
+			creds, err := config.Credentials.Retrieve(ctx)
+			if err != nil {
+				return sigv4.Credentials{}, err
+			}
+			return sigv4.Credentials{
+				AccessKeyID:     creds.AccessKeyID,
+				SecretAccessKey: creds.SecretAccessKey,
+				SessionToken:    creds.SessionToken,
+			}, nil
+		})
+	} else {
+		provider = &sigv4.DefaultProvider{
+			Container: &sigv4.ContainerProvider{
+				Client: &http.Client{Timeout: 10 * time.Second},
+			},
+		}
+	}
+	s.signer = &apiSigner{
+		region:   region,
+		provider: provider,
+	}
+	return s, nil
+}
+
+// apiSigner signs the requests to the AWS X-Ray API.
+type apiSigner struct {
+	region   string
+	provider sigv4.Provider
+
+	// returns current time.
+	nowFunc func() time.Time
+}
+
+func (s *apiSigner) sign(ctx context.Context, req *http.Request, body []byte) error {
+	creds, err := s.provider.Retrieve(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now
+	if s.nowFunc != nil {
+		now = s.nowFunc
+	}
+	sigv4.Sign(req, body, creds, "xray", s.region, now())
+	return nil
+}
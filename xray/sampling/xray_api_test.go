@@ -0,0 +1,126 @@
+package sampling
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/shogo82148/aws-xray-yasdk-go/internal/sigv4"
+)
+
+type staticCredentials Credentials
+
+func (c staticCredentials) Retrieve(ctx context.Context) (Credentials, error) {
+	return Credentials(c), nil
+}
+
+// verifySignature checks the signature of req in the same way as AWS does.
+func verifySignature(t *testing.T, req *http.Request, creds sigv4.Credentials, region string) {
+	t.Helper()
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	signedAt, err := time.Parse("20060102T150405Z", req.Header.Get("X-Amz-Date"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := http.NewRequest(req.Method, "http://"+req.Host+req.URL.RequestURI(), bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want.Header.Set("Content-Type", req.Header.Get("Content-Type"))
+	sigv4.Sign(want, body, creds, "xray", region, signedAt)
+
+	if got, want := req.Header.Get("Authorization"), want.Header.Get("Authorization"); got != want {
+		t.Errorf("invalid signature: want %q, got %q", want, got)
+	}
+	if got, want := req.Header.Get("X-Amz-Security-Token"), creds.SessionToken; got != want {
+		t.Errorf("invalid security token: want %q, got %q", want, got)
+	}
+}
+
+func TestCentralizedStrategyWithXRayAPI(t *testing.T) {
+	creds := sigv4.Credentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		SessionToken:    "session-token",
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		verifySignature(t, req, creds, "ap-northeast-1")
+		switch req.URL.Path {
+		case "/GetSamplingRules":
+			json.NewEncoder(w).Encode(&getSamplingRulesOutput{
+				SamplingRuleRecords: []*samplingRuleRecord{
+					{
+						SamplingRule: samplingRule{
+							RuleName:    "Default",
+							Priority:    10000,
+							Host:        "*",
+							HTTPMethod:  "*",
+							URLPath:     "*",
+							ServiceName: "*",
+							ServiceType: "*",
+							ResourceARN: "*",
+							FixedRate:   0.05,
+						},
+					},
+				},
+			})
+		default:
+			t.Errorf("unexpected path: %s", req.URL.Path)
+			http.NotFound(w, req)
+		}
+	}))
+	defer ts.Close()
+
+	s, err := NewCentralizedStrategyWithXRayAPI(&XRayAPIConfig{
+		Region:   "ap-northeast-1",
+		Endpoint: ts.URL,
+		Credentials: staticCredentials{
+			AccessKeyID:     creds.AccessKeyID,
+			SecretAccessKey: creds.SecretAccessKey,
+			SessionToken:    creds.SessionToken,
+		},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.refreshRule(); err != nil {
+		t.Fatal(err)
+	}
+	manifest := s.getManifest()
+	if len(manifest.Rules) != 1 || manifest.Rules[0].ruleName != "Default" {
+		t.Errorf("unexpected rules: %v", manifest.Rules)
+	}
+}
+
+func TestNewCentralizedStrategyWithXRayAPI_Region(t *testing.T) {
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+	if _, err := NewCentralizedStrategyWithXRayAPI(nil, nil); err == nil {
+		t.Error("want error, got nil")
+	}
+
+	t.Setenv("AWS_DEFAULT_REGION", "cn-north-1")
+	s, err := NewCentralizedStrategyWithXRayAPI(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if want := "https://xray.cn-north-1.amazonaws.com.cn"; s.endpoint != want {
+		t.Errorf("want %q, got %q", want, s.endpoint)
+	}
+	if s.signer.region != "cn-north-1" {
+		t.Errorf("want %q, got %q", "cn-north-1", s.signer.region)
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"maps"
 	"net/http"
 	"os"
 	"strings"
@@ -28,9 +30,11 @@ type contextKey struct {
 func (k *contextKey) String() string { return "xray context value " + k.name }
 
 var (
-	segmentContextKey = &contextKey{"segment"}
-	clientContextKey  = &contextKey{"client"}
-	traceIDContextKey = &contextKey{"trace-id"}
+	segmentContextKey           = &contextKey{"segment"}
+	clientContextKey            = &contextKey{"client"}
+	traceIDContextKey           = &contextKey{"trace-id"}
+	samplingRequestedContextKey = &contextKey{"sampling-requested"}
+	samplingAttrsContextKey     = &contextKey{"sampling-attributes"}
 )
 
 type segmentStatus int
@@ -104,6 +108,25 @@ type Segment struct {
 	sampled  bool
 	ruleName string
 
+	// samplingDeferred is true while the root segment waits for
+	// the sampling decision from downstream services.
+	// sampled holds the local decision that is used if no downstream service decides.
+	samplingDeferred bool
+
+	// deferMaxSegments is the maximum number of the segments recorded while the decision is deferred.
+	// It is zero if the decision is not deferred.
+	deferMaxSegments int
+
+	// tailSampler is not nil while the root segment that isn't sampled
+	// is recorded for tail sampling.
+	tailSampler *tailSampler
+
+	// tailRequest is the sampling request of the root segment recorded for tail sampling.
+	tailRequest *sampling.Request
+
+	// tailTimer discards the trace recorded for tail sampling if the root segment is not closed in time.
+	tailTimer *time.Timer
+
 	// parent segment
 	// if the segment is the root, the parent is nil.
 	parent *Segment
@@ -123,6 +146,14 @@ type Segment struct {
 	closedSegments  int
 	emittedSegments int
 
+	// the number of annotations in the trace, used in the root.
+	totalAnnotations int
+
+	// the durations of the closed subsegments of the root, used in the root.
+	// they are recorded only if recordTimings is true.
+	recordTimings bool
+	timings       []Timing
+
 	// error information
 	error    bool
 	throttle bool
@@ -137,6 +168,9 @@ type Segment struct {
 	sql         *schema.SQL
 	http        *schema.HTTP
 	aws         schema.AWS
+
+	// the total size of the JSON-encoded metadata.
+	metadataSize int
 }
 
 // NewTraceID generates a string format of random trace ID.
@@ -203,6 +237,23 @@ func WithSegment(ctx context.Context, seg *Segment) context.Context {
 	return context.WithValue(ctx, segmentContextKey, seg)
 }
 
+// WithSamplingAttributes returns a new context with the attributes for sampling decisions.
+// The segments that begin with the context pass the attributes to the sampling strategy,
+// and the sampling rules can match on them.
+// The attributes are merged with the attributes that the ctx already has.
+func WithSamplingAttributes(ctx context.Context, attrs map[string]string) context.Context {
+	parent := contextSamplingAttributes(ctx)
+	merged := make(map[string]string, len(parent)+len(attrs))
+	maps.Copy(merged, parent)
+	maps.Copy(merged, attrs)
+	return context.WithValue(ctx, samplingAttrsContextKey, merged)
+}
+
+func contextSamplingAttributes(ctx context.Context) map[string]string {
+	attrs, _ := ctx.Value(samplingAttrsContextKey).(map[string]string)
+	return attrs
+}
+
 // BeginDummySegment creates a new segment that traces nothing.
 func BeginDummySegment(ctx context.Context) (context.Context, *Segment) {
 	return WithSegment(ctx, nil), nil
@@ -212,14 +263,14 @@ func BeginDummySegment(ctx context.Context) (context.Context, *Segment) {
 //
 // Caller should close the segment when the work is done.
 func BeginSegment(ctx context.Context, name string) (context.Context, *Segment) {
-	return beginSegment(ctx, nowFunc(), name, TraceHeader{}, nil)
+	return beginSegment(ctx, name, &segmentOptions{now: nowFunc()})
 }
 
 // BeginSegmentAt creates a new Segment for a given time, name and context.
 //
 // Caller should close the segment when the work is done.
 func BeginSegmentAt(ctx context.Context, now time.Time, name string) (context.Context, *Segment) {
-	return beginSegment(ctx, now, name, TraceHeader{}, nil)
+	return beginSegment(ctx, name, &segmentOptions{now: now})
 }
 
 // BeginSegmentWithRequest creates a new Segment for a given name and context.
@@ -227,7 +278,7 @@ func BeginSegmentAt(ctx context.Context, now time.Time, name string) (context.Co
 //
 // Caller should close the segment when the work is done.
 func BeginSegmentWithRequest(ctx context.Context, name string, r *http.Request) (context.Context, *Segment) {
-	return beginSegment(ctx, nowFunc(), name, TraceHeader{}, r)
+	return BeginSegmentWithOptions(ctx, name, WithHTTPRequest(r))
 }
 
 // BeginSegmentWithHeader creates a new Segment for a given name, context, and trace header.
@@ -236,23 +287,38 @@ func BeginSegmentWithRequest(ctx context.Context, name string, r *http.Request)
 //
 // Caller should close the segment when the work is done.
 func BeginSegmentWithHeader(ctx context.Context, name, header string) (context.Context, *Segment) {
-	return beginSegment(ctx, nowFunc(), name, ParseTraceHeader(header), nil)
+	return BeginSegmentWithOptions(ctx, name, WithTraceHeader(header))
+}
+
+// BeginSegmentWithOptions creates a new Segment for a given name, context and options.
+// The options describe the entry point for the sampling rules,
+// so the rules can match on the requests that are not HTTP, e.g. messages of queues, jobs and RPCs.
+//
+// Caller should close the segment when the work is done.
+func BeginSegmentWithOptions(ctx context.Context, name string, opts ...SegmentOption) (context.Context, *Segment) {
+	o := &segmentOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.now.IsZero() {
+		o.now = nowFunc()
+	}
+	return beginSegment(ctx, name, o)
 }
 
 // beginSegment creates a new Segment for a given name and context.
-func beginSegment(ctx context.Context, now time.Time, name string, h TraceHeader, r *http.Request) (context.Context, *Segment) {
+func beginSegment(ctx context.Context, name string, o *segmentOptions) (context.Context, *Segment) {
 	// inject trace id into the context
-	if r != nil {
-		h = ParseTraceHeader(r.Header.Get(TraceIDHeaderKey))
-	}
+	h := o.header
 	if h.TraceID == "" {
 		h.TraceID = NewTraceID()
 	}
 	ctx = withTraceID(ctx, h.TraceID)
 
 	// return dummy segment if X-Ray SDK is disabled.
-	client := ContextClient(ctx)
-	if client != nil && client.disabled {
+	config, release := ContextClient(ctx).acquireConfig()
+	defer release()
+	if config.disabled {
 		return BeginDummySegment(ctx)
 	}
 
@@ -260,49 +326,93 @@ func beginSegment(ctx context.Context, now time.Time, name string, h TraceHeader
 		ctx:           ctx,
 		name:          sanitizeSegmentName(name),
 		id:            NewSegmentID(),
-		startTime:     now,
+		startTime:     o.now,
 		totalSegments: 1,
 		origin:        origin(),
+		recordTimings: o.recordTimings,
 	}
 	seg.root = seg
 
-	if r != nil {
+	arn := config.resourceARN
+	if arn == "" {
+		arn = resourceARN()
+	}
+
+	// the upstream service requests us to make the sampling decision.
+	requested := h.SamplingDecision == SamplingDecisionRequested
+
+	attrs := contextSamplingAttributes(ctx)
+	if len(o.attributes) > 0 {
+		attrs = maps.Clone(attrs)
+		if attrs == nil {
+			attrs = make(map[string]string, len(o.attributes))
+		}
+		maps.Copy(attrs, o.attributes)
+	}
+	req := &sampling.Request{
+		Host:        o.host,
+		URL:         o.path,
+		Method:      o.method,
+		UserAgent:   o.userAgent,
+		ServiceName: seg.name,
+		ServiceType: seg.origin,
+		ResourceARN: arn,
+		Attributes:  attrs,
+	}
+
+	switch {
+	case o.sampled != nil:
+		xraylog.Debugf(ctx, "Forced decision: Sampled=%t", *o.sampled)
+		seg.sampled = *o.sampled
+	case o.http && h.SamplingDecision == SamplingDecisionSampled:
 		// Sampling strategy for http calls
-		switch h.SamplingDecision {
-		case SamplingDecisionSampled:
-			xraylog.Debug(ctx, "Incoming header decided: Sampled=true")
-			seg.sampled = true
-		case SamplingDecisionNotSampled:
-			xraylog.Debug(ctx, "Incoming header decided: Sampled=false")
-		default:
-			sd := client.samplingStrategy.ShouldTrace(&sampling.Request{
-				Host:        r.Host,
-				URL:         r.URL.Path,
-				Method:      r.Method,
-				ServiceName: seg.name,
-				ServiceType: seg.origin,
-			})
-			seg.sampled = sd.Sample
-			if sd.Rule != nil {
-				seg.ruleName = *sd.Rule
+		xraylog.Debug(ctx, "Incoming header decided: Sampled=true")
+		seg.sampled = true
+	case o.http && h.SamplingDecision == SamplingDecisionNotSampled:
+		xraylog.Debug(ctx, "Incoming header decided: Sampled=false")
+	default:
+		if !o.http {
+			switch h.SamplingDecision {
+			case SamplingDecisionSampled:
+				req.ParentSampled = new(bool)
+				*req.ParentSampled = true
+			case SamplingDecisionNotSampled:
+				req.ParentSampled = new(bool)
 			}
-			xraylog.Debugf(ctx, "SamplingStrategy decided: %t", seg.sampled)
 		}
-	} else {
-		sd := client.samplingStrategy.ShouldTrace(&sampling.Request{
-			ServiceName: seg.name,
-			ServiceType: seg.origin,
-		})
-		seg.sampled = sd.Sample
-		if sd.Rule != nil {
-			seg.ruleName = *sd.Rule
+		seg.shouldTrace(config.samplingStrategy, req)
+	}
+
+	if requested {
+		// tell the decision to the upstream service.
+		decision := SamplingDecisionNotSampled
+		if seg.sampled {
+			decision = SamplingDecisionSampled
 		}
-		xraylog.Debugf(ctx, "SamplingStrategy decided: %t", seg.sampled)
+		ctx = context.WithValue(ctx, samplingRequestedContextKey, TraceHeader{
+			TraceID:          h.TraceID,
+			SamplingDecision: decision,
+		})
+		seg.ctx = ctx
+	} else if h.SamplingDecision == SamplingDecisionUnknown && o.sampled == nil && config.deferSamplingDecision {
+		// record the segment until the downstream services decide.
+		xraylog.Debug(ctx, "Sampling decision is deferred to downstream services")
+		seg.samplingDeferred = true
+		seg.deferMaxSegments = config.deferMaxSegments
+		h.SamplingDecision = SamplingDecisionRequested
 	}
-	if seg.sampled {
-		h.SamplingDecision = SamplingDecisionSampled
-	} else {
-		return BeginDummySegment(ctx)
+
+	if !seg.samplingDeferred {
+		if !seg.sampled {
+			// the forced decision is never overridden by tail sampling.
+			if o.sampled != nil || !seg.beginTailSampling(config.tailSampler, h, req) {
+				return BeginDummySegment(ctx)
+			}
+			// the downstream services see the same decision as without tail sampling.
+			h.SamplingDecision = SamplingDecisionNotSampled
+		} else {
+			h.SamplingDecision = SamplingDecisionSampled
+		}
 	}
 
 	seg.traceID = h.TraceID
@@ -311,6 +421,69 @@ func beginSegment(ctx context.Context, now time.Time, name string, h TraceHeader
 	return WithSegment(ctx, seg), seg
 }
 
+// beginTailSampling starts recording the root segment that isn't sampled for tail sampling.
+// It returns false if tail sampling is disabled, the upstream service decided, or the budget is exhausted.
+func (seg *Segment) beginTailSampling(s *tailSampler, h TraceHeader, req *sampling.Request) bool {
+	if s == nil {
+		return false
+	}
+	if h.SamplingDecision == SamplingDecisionSampled || h.SamplingDecision == SamplingDecisionNotSampled {
+		// respect the decision of the upstream service.
+		return false
+	}
+	if !s.acquire() {
+		xraylog.Debug(seg.ctx, "Tail sampling: the budget is exhausted, the trace is not recorded")
+		return false
+	}
+	xraylog.Debug(seg.ctx, "Tail sampling: the trace is recorded until the root segment is closed")
+	seg.tailSampler = s
+	seg.tailRequest = req
+	seg.tailTimer = time.AfterFunc(s.maxDuration, seg.expireTailSampling)
+	return true
+}
+
+// expireTailSampling discards the trace that is recorded for tail sampling longer than TailSamplingConfig.MaxTraceDuration,
+// and returns its budget. seg should be the root.
+func (seg *Segment) expireTailSampling() {
+	seg.mu.Lock()
+	defer seg.mu.Unlock()
+	s := seg.tailSampler
+	if s == nil {
+		// the root segment is already closed.
+		return
+	}
+	xraylog.Debug(seg.ctx, "Tail sampling: the root segment is not closed in time, the trace is discarded")
+	seg.tailSampler = nil
+	seg.tailRequest = nil
+	s.release()
+}
+
+// shouldTrace makes the sampling decision of the root segment.
+func (seg *Segment) shouldTrace(strategy sampling.Strategy, req *sampling.Request) {
+	sd := strategy.ShouldTrace(req)
+	if sd == nil {
+		// no strategy has any opinion.
+		xraylog.Debug(seg.ctx, "SamplingStrategy has no opinion, the segment is not sampled")
+		return
+	}
+	seg.sampled = sd.Sample
+	if sd.Rule != nil {
+		seg.ruleName = *sd.Rule
+	}
+	if sd.DecidedBy != "" {
+		xraylog.Debugf(seg.ctx, "SamplingStrategy decided: %t by %s", seg.sampled, sd.DecidedBy)
+	} else {
+		xraylog.Debugf(seg.ctx, "SamplingStrategy decided: %t", seg.sampled)
+	}
+}
+
+// ResponseTraceHeader returns the trace header that should be returned to the upstream service in the response.
+// It is available only if the upstream service requested the sampling decision by "Sampled=?".
+func ResponseTraceHeader(ctx context.Context) (TraceHeader, bool) {
+	h, ok := ctx.Value(samplingRequestedContextKey).(TraceHeader)
+	return h, ok
+}
+
 // BeginSubsegmentAt creates a new Segment for a given time, name and context.
 //
 // Caller should close the segment when the work is done.
@@ -326,7 +499,7 @@ func BeginSubsegmentAt(ctx context.Context, now time.Time, name string) (context
 		if c := ctx.Value(clientContextKey); c != nil {
 			client = c.(*Client)
 		}
-		client.contextMissingStrategy.ContextMissing(ctx, "context missing for "+name)
+		client.getConfig().contextMissingStrategy.ContextMissing(ctx, "context missing for "+name)
 		return ctx, nil
 	}
 	parent := value.(*Segment)
@@ -344,7 +517,6 @@ func BeginSubsegmentAt(ctx context.Context, now time.Time, name string) (context
 		traceID:   parent.traceID,
 		startTime: now,
 	}
-	ctx = context.WithValue(ctx, segmentContextKey, seg)
 
 	root.mu.Lock()
 	defer root.mu.Unlock()
@@ -352,10 +524,24 @@ func BeginSubsegmentAt(ctx context.Context, now time.Time, name string) (context
 		parent.mu.Lock()
 		defer parent.mu.Unlock()
 	}
+	if s := root.tailSampler; s != nil && root.totalSegments >= s.maxSegments {
+		xraylog.Debugf(ctx, "Tail sampling: the trace has too many segments, %s is dropped", seg.name)
+		return WithSegment(ctx, nil), nil
+	}
+	if root.deferMaxSegments > 0 {
+		if root.samplingDeferred && root.totalSegments >= root.deferMaxSegments {
+			xraylog.Debugf(ctx, "Deferred sampling: the trace has too many segments, fallback to the local decision: Sampled=%t", root.sampled)
+			root.resolveSamplingDecisionLocked(root.sampled)
+		}
+		if !root.samplingDeferred && !root.sampled {
+			// the trace is never emitted, so stop recording it.
+			return WithSegment(ctx, nil), nil
+		}
+	}
 	root.totalSegments++
 	parent.subsegments = append(parent.subsegments, seg)
 
-	return ctx, seg
+	return context.WithValue(ctx, segmentContextKey, seg), seg
 }
 
 // BeginSubsegment creates a new Segment for a given name and context.
@@ -366,6 +552,8 @@ func BeginSubsegment(ctx context.Context, name string) (context.Context, *Segmen
 }
 
 // Sampled returns whether the current segment is sampled.
+// If the sampling decision is deferred to downstream services and they have not decided yet,
+// it returns the local decision.
 func (seg *Segment) Sampled() bool {
 	if seg == nil {
 		return false
@@ -400,7 +588,7 @@ func (seg *Segment) Close() {
 	}
 	err := recover()
 	seg.AddPanic(err)
-	if seg.Sampled() {
+	if seg.shouldEmit() {
 		seg.emit()
 	}
 	if err != nil {
@@ -421,9 +609,83 @@ func (seg *Segment) close() bool {
 	}
 	root.closedSegments++
 	seg.endTime = nowFunc()
+	if root.recordTimings && seg.parent == root && len(root.timings) < maxTimings {
+		root.timings = append(root.timings, Timing{
+			Name:     seg.name,
+			Duration: seg.endTime.Sub(seg.startTime),
+		})
+	}
 	return true
 }
 
+// shouldEmit returns whether the closed segment should be emitted.
+func (seg *Segment) shouldEmit() bool {
+	root := seg.root
+	root.mu.Lock()
+	defer root.mu.Unlock()
+	if root.samplingDeferred {
+		if seg != root {
+			// wait for the decision. the root will emit the subsegments.
+			return false
+		}
+		// no downstream service decided. fallback to the local decision.
+		root.resolveSamplingDecisionLocked(root.sampled)
+	}
+	if s := root.tailSampler; s != nil {
+		if seg != root {
+			// wait for the decision. the root will emit the subsegments.
+			return false
+		}
+		root.tailSampler = nil
+		root.tailTimer.Stop()
+		s.release()
+		root.sampled = s.keepLocked(root)
+		if root.sampled {
+			xraylog.Debug(seg.ctx, "Tail sampling: the trace is emitted")
+		} else {
+			xraylog.Debug(seg.ctx, "Tail sampling: the trace is discarded")
+		}
+	}
+	return root.sampled
+}
+
+// resolveSamplingDecisionLocked finishes the deferred sampling decision.
+// seg should be the root, and seg.mu should be locked.
+func (seg *Segment) resolveSamplingDecisionLocked(sampled bool) {
+	seg.samplingDeferred = false
+	seg.sampled = sampled
+	if sampled {
+		seg.traceHeader.SamplingDecision = SamplingDecisionSampled
+	} else {
+		seg.traceHeader.SamplingDecision = SamplingDecisionNotSampled
+	}
+}
+
+// ResolveSamplingDecision sets the sampling decision that a downstream service made.
+// It has effect only if the sampling decision of the trace is deferred by Config.DeferSamplingDecision,
+// and the first decision wins.
+func (seg *Segment) ResolveSamplingDecision(decision SamplingDecision) {
+	if seg == nil {
+		return
+	}
+	if decision != SamplingDecisionSampled && decision != SamplingDecisionNotSampled {
+		return
+	}
+	root := seg.root
+	root.mu.Lock()
+	defer root.mu.Unlock()
+	if !root.samplingDeferred {
+		return
+	}
+	xraylog.Debugf(seg.ctx, "Downstream service decided: Sampled=%t", decision == SamplingDecisionSampled)
+	root.resolveSamplingDecisionLocked(decision == SamplingDecisionSampled)
+}
+
+// ResolveSamplingDecision sets the sampling decision that a downstream service made.
+func ResolveSamplingDecision(ctx context.Context, decision SamplingDecision) {
+	ContextSegment(ctx).ResolveSamplingDecision(decision)
+}
+
 func (seg *Segment) isRoot() bool {
 	return seg.parent == nil
 }
@@ -550,11 +812,19 @@ func (seg *Segment) downstreamHeader() TraceHeader {
 	if seg == nil {
 		return TraceHeader{}
 	}
-	seg.mu.RLock()
-	defer seg.mu.RUnlock()
+	root := seg.root
+	root.mu.RLock()
+	defer root.mu.RUnlock()
+	if seg != root {
+		seg.mu.RLock()
+		defer seg.mu.RUnlock()
+	}
 	h := seg.traceHeader
 	h.TraceID = seg.traceID
 	h.ParentID = seg.id
+
+	// the sampling decision is shared in the trace.
+	h.SamplingDecision = root.traceHeader.SamplingDecision
 	return h
 }
 
@@ -606,12 +876,38 @@ func AddMetadata(ctx context.Context, key string, value any) {
 }
 
 // AddMetadataToNamespace adds metadata.
+// The value is encoded into JSON immediately.
+// If the value can't be encoded, or it exceeds the limits of the client,
+// a placeholder that describes the reason is recorded instead.
 func (seg *Segment) AddMetadataToNamespace(namespace, key string, value any) {
 	if seg == nil {
 		return
 	}
+	config := seg.client().getConfig()
+	data := encodeMetadata(value, config.maxMetadataDepth)
+
 	seg.mu.Lock()
 	defer seg.mu.Unlock()
+	seg.addMetadataLocked(namespace, key, data, config.maxMetadataBytesPerSegment)
+}
+
+// addMetadataLocked adds the JSON-encoded metadata. seg.mu should be locked.
+func (seg *Segment) addMetadataLocked(namespace, key string, data json.RawMessage, budget int) {
+	var oldSize int
+	if ns, ok := seg.metadata[namespace].(map[string]any); ok {
+		if old, ok := ns[key].(json.RawMessage); ok {
+			oldSize = len(old)
+		}
+	}
+	if budget > 0 && seg.metadataSize-oldSize+len(data) > budget {
+		// replace with the placeholder to tell users what happened.
+		data = metadataPlaceholder("", fmt.Errorf("xray: metadata exceeds the budget of the segment: %d bytes", len(data)))
+		if seg.metadataSize-oldSize+len(data) > budget {
+			xraylog.Warnf(seg.ctx, "xray: metadata %s.%s exceeds the budget of the segment, dropped", namespace, key)
+			return
+		}
+	}
+
 	if seg.metadata == nil {
 		seg.metadata = map[string]any{}
 	}
@@ -619,13 +915,14 @@ func (seg *Segment) AddMetadataToNamespace(namespace, key string, value any) {
 		seg.metadata[namespace] = map[string]any{}
 	}
 	if ns, ok := seg.metadata[namespace].(map[string]any); ok {
-		ns[key] = value
+		ns[key] = data
+		seg.metadataSize += len(data) - oldSize
 	}
 }
 
 // AddMetadataToNamespace adds metadata.
 func AddMetadataToNamespace(ctx context.Context, namespace, key string, value any) {
-	ContextSegment(ctx).AddMetadata(key, value)
+	ContextSegment(ctx).AddMetadataToNamespace(namespace, key, value)
 }
 
 // SetSQL sets the information of SQL queries.
@@ -714,18 +1011,6 @@ func SetUser(ctx context.Context, user string) {
 	ContextSegment(ctx).SetUser(user)
 }
 
-func (seg *Segment) addAnnotation(key string, value any) {
-	if seg == nil {
-		return
-	}
-	seg.mu.Lock()
-	defer seg.mu.Unlock()
-	if seg.annotations == nil {
-		seg.annotations = make(map[string]any)
-	}
-	seg.annotations[key] = value
-}
-
 // AddAnnotationBool adds a boolean type annotation.
 func (seg *Segment) AddAnnotationBool(key string, value bool) {
 	seg.addAnnotation(key, value)
@@ -0,0 +1,119 @@
+package xray
+
+import (
+	"maps"
+	"net/http"
+	"time"
+)
+
+// SegmentOption is an option of BeginSegmentWithOptions.
+type SegmentOption func(*segmentOptions)
+
+type segmentOptions struct {
+	// the time when the segment begins.
+	now time.Time
+
+	// the trace header of the upstream service.
+	header TraceHeader
+
+	// http is true if the segment traces an HTTP request.
+	// The sampling decision in the header of HTTP requests is respected without asking the strategy.
+	http bool
+
+	// the parameters for the sampling rules.
+	host       string
+	method     string
+	path       string
+	userAgent  string
+	attributes map[string]string
+
+	// the forced sampling decision.
+	sampled *bool
+
+	// recordTimings records the durations of the subsegments.
+	recordTimings bool
+}
+
+// WithStartTime configures the time when the segment begins.
+// By default, the current time is used.
+func WithStartTime(now time.Time) SegmentOption {
+	return func(o *segmentOptions) {
+		o.now = now
+	}
+}
+
+// WithTraceHeader configures the trace header that the upstream service propagates,
+// e.g. the AWSTraceHeader attribute of Amazon SQS messages.
+// The sampling decision in the header is passed to the sampling strategy as the parent's decision.
+func WithTraceHeader(header string) SegmentOption {
+	return func(o *segmentOptions) {
+		o.header = ParseTraceHeader(header)
+	}
+}
+
+// WithHTTPRequest configures the segment for the HTTP request.
+// The trace header, the host, the method, the path and the user agent are taken from r.
+// A nil r is ignored.
+func WithHTTPRequest(r *http.Request) SegmentOption {
+	return func(o *segmentOptions) {
+		if r == nil {
+			return
+		}
+		o.header = ParseTraceHeader(r.Header.Get(TraceIDHeaderKey))
+		o.http = true
+		o.host = r.Host
+		o.method = r.Method
+		o.path = r.URL.Path
+		o.userAgent = r.UserAgent()
+	}
+}
+
+// WithHost configures the host that the sampling rules match on.
+func WithHost(host string) SegmentOption {
+	return func(o *segmentOptions) {
+		o.host = host
+	}
+}
+
+// WithMethod configures the method that the sampling rules match on.
+// For non-HTTP entry points, it may be the name of the operation, e.g. the gRPC method or the job name.
+func WithMethod(method string) SegmentOption {
+	return func(o *segmentOptions) {
+		o.method = method
+	}
+}
+
+// WithPath configures the path that the sampling rules match on.
+// For non-HTTP entry points, it may be the name of the resource, e.g. the queue name.
+func WithPath(path string) SegmentOption {
+	return func(o *segmentOptions) {
+		o.path = path
+	}
+}
+
+// WithAttributes configures the attributes that the sampling rules match on.
+// The attributes are merged with the attributes set by WithSamplingAttributes.
+func WithAttributes(attrs map[string]string) SegmentOption {
+	return func(o *segmentOptions) {
+		if o.attributes == nil {
+			o.attributes = make(map[string]string, len(attrs))
+		}
+		maps.Copy(o.attributes, attrs)
+	}
+}
+
+// WithSampled forces the sampling decision of the segment.
+// Neither the sampling strategy nor the decision of the upstream service is consulted.
+func WithSampled(sampled bool) SegmentOption {
+	return func(o *segmentOptions) {
+		o.sampled = &sampled
+	}
+}
+
+// WithTimings records the durations of the subsegments that are direct children of the segment.
+// They are available through [Segment.Timings], e.g. for the Server-Timing header of HTTP responses.
+func WithTimings() SegmentOption {
+	return func(o *segmentOptions) {
+		o.recordTimings = true
+	}
+}
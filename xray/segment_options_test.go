@@ -0,0 +1,117 @@
+package xray
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/shogo82148/aws-xray-yasdk-go/xray/sampling"
+)
+
+func TestBeginSegmentWithOptions(t *testing.T) {
+	ctx, td := NewTestDaemon(nil)
+	defer td.Close()
+
+	var got *sampling.Request
+	if err := ContextClient(ctx).Reconfigure(&Config{
+		DaemonAddress: td.DaemonAddress(),
+		SamplingStrategy: sampling.StrategyFunc(func(req *sampling.Request) *sampling.Decision {
+			got = req
+			return &sampling.Decision{Sample: true}
+		}),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx = WithSamplingAttributes(ctx, map[string]string{"tenant": "foo"})
+	_, seg := BeginSegmentWithOptions(
+		ctx, "worker",
+		WithHost("orders.fifo"),
+		WithMethod("Receive"),
+		WithPath("/orders"),
+		WithAttributes(map[string]string{"priority": "high"}),
+		WithTraceHeader("Root=1-5e645f3e-1dfad076a177c5ccc5de12f5;Sampled=1"),
+	)
+	seg.Close()
+
+	sampled := true
+	want := &sampling.Request{
+		Host:          "orders.fifo",
+		Method:        "Receive",
+		URL:           "/orders",
+		ServiceName:   "worker",
+		ServiceType:   origin(),
+		Attributes:    map[string]string{"tenant": "foo", "priority": "high"},
+		ParentSampled: &sampled,
+	}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(sampling.Request{}, "ResourceARN")); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	if seg.traceID != "1-5e645f3e-1dfad076a177c5ccc5de12f5" {
+		t.Errorf("unexpected trace id: %s", seg.traceID)
+	}
+
+	// the attributes of the context are not changed.
+	if diff := cmp.Diff(map[string]string{"tenant": "foo"}, contextSamplingAttributes(ctx)); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestBeginSegmentWithOptions_WithSampled(t *testing.T) {
+	ctx, td := NewTestDaemon(nil)
+	defer td.Close()
+
+	if err := ContextClient(ctx).Reconfigure(&Config{
+		DaemonAddress: td.DaemonAddress(),
+		SamplingStrategy: sampling.StrategyFunc(func(req *sampling.Request) *sampling.Decision {
+			t.Error("the strategy should not be called")
+			return &sampling.Decision{Sample: false}
+		}),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the forced decision wins over the upstream decision.
+	_, seg := BeginSegmentWithOptions(
+		ctx, "cron",
+		WithTraceHeader("Root=1-5e645f3e-1dfad076a177c5ccc5de12f5;Sampled=0"),
+		WithSampled(true),
+	)
+	if seg == nil {
+		t.Fatal("want the segment to be sampled")
+	}
+	seg.Close()
+
+	got, err := td.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "cron" {
+		t.Errorf("want %q, got %q", "cron", got.Name)
+	}
+
+	_, seg = BeginSegmentWithOptions(ctx, "cron", WithSampled(false))
+	if seg != nil {
+		t.Error("want the segment not to be sampled")
+	}
+}
+
+func TestBeginSegmentWithRequest_Nil(t *testing.T) {
+	ctx, td := NewTestDaemon(nil)
+	defer td.Close()
+
+	// a nil request is same as no request.
+	_, seg := BeginSegmentWithRequest(ctx, "nil-request", nil)
+	if seg == nil {
+		t.Fatal("want segment, got nil")
+	}
+	seg.Close()
+
+	got, err := td.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "nil-request" {
+		t.Errorf("want %q, got %q", "nil-request", got.Name)
+	}
+}
@@ -3,6 +3,7 @@ package xray
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"regexp"
 	"runtime"
@@ -11,6 +12,7 @@ import (
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/shogo82148/aws-xray-yasdk-go/xray/sampling"
 	"github.com/shogo82148/aws-xray-yasdk-go/xray/schema"
 )
 
@@ -213,6 +215,195 @@ func TestBeginSegmentWithRequest_Sampled(t *testing.T) {
 	}
 }
 
+func TestBeginSegmentWithRequest_SamplingRequested(t *testing.T) {
+	tests := []struct {
+		sample bool
+		want   string
+	}{
+		{sample: true, want: "Root=1-5e645f3e-1dfad076a177c5ccc5de12f5;Sampled=1"},
+		{sample: false, want: "Root=1-5e645f3e-1dfad076a177c5ccc5de12f5;Sampled=0"},
+	}
+	for _, tt := range tests {
+		ctx, td := NewTestDaemon(nil)
+		defer td.Close()
+		if err := ContextClient(ctx).Reconfigure(&Config{
+			DaemonAddress: td.DaemonAddress(),
+			SamplingStrategy: sampling.StrategyFunc(func(req *sampling.Request) *sampling.Decision {
+				return &sampling.Decision{Sample: tt.sample}
+			}),
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// trace header with "Sampled=?"
+		req.Header.Set(TraceIDHeaderKey, "Root=1-5e645f3e-1dfad076a177c5ccc5de12f5;Sampled=?")
+		ctx, seg := BeginSegmentWithRequest(ctx, "foobar", req)
+		h, ok := ResponseTraceHeader(ctx)
+		if !ok {
+			t.Fatal("want ok, got not ok")
+		}
+		if h.String() != tt.want {
+			t.Errorf("want %q, got %q", tt.want, h.String())
+		}
+		seg.Close()
+	}
+}
+
+func TestWithSamplingAttributes(t *testing.T) {
+	ctx, td := NewTestDaemon(nil)
+	defer td.Close()
+
+	var got map[string]string
+	if err := ContextClient(ctx).Reconfigure(&Config{
+		DaemonAddress: td.DaemonAddress(),
+		SamplingStrategy: sampling.StrategyFunc(func(req *sampling.Request) *sampling.Decision {
+			got = req.Attributes
+			return &sampling.Decision{Sample: true}
+		}),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx = WithSamplingAttributes(ctx, map[string]string{"tenant": "foo", "tier": "free"})
+	ctx = WithSamplingAttributes(ctx, map[string]string{"tier": "premium"})
+	_, seg := BeginSegment(ctx, "foobar")
+	seg.Close()
+
+	want := map[string]string{"tenant": "foo", "tier": "premium"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestBeginSegment_DeferSamplingDecision(t *testing.T) {
+	tests := []struct {
+		name     string
+		decision SamplingDecision
+		local    bool
+		want     bool
+	}{
+		{name: "downstream sampled", decision: SamplingDecisionSampled, local: false, want: true},
+		{name: "downstream not sampled", decision: SamplingDecisionNotSampled, local: true, want: false},
+		{name: "fallback to local sampled", decision: SamplingDecisionUnknown, local: true, want: true},
+		{name: "fallback to local not sampled", decision: SamplingDecisionUnknown, local: false, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, td := NewTestDaemon(nil)
+			defer td.Close()
+			if err := ContextClient(ctx).Reconfigure(&Config{
+				DaemonAddress: td.DaemonAddress(),
+				SamplingStrategy: sampling.StrategyFunc(func(req *sampling.Request) *sampling.Decision {
+					return &sampling.Decision{Sample: tt.local}
+				}),
+				StreamingStrategy:     NewStreamingStrategyLimitSubsegment(0),
+				DeferSamplingDecision: true,
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, seg := BeginSegment(ctx, "foobar")
+			if seg == nil {
+				t.Fatal("want segment, got nil")
+			}
+			subCtx, sub := BeginSubsegment(ctx, "downstream")
+			if h := DownstreamHeader(subCtx); h.SamplingDecision != SamplingDecisionRequested {
+				t.Errorf("want %q, got %q", SamplingDecisionRequested, h.SamplingDecision)
+			}
+			ResolveSamplingDecision(subCtx, tt.decision)
+			sub.Close()
+			if tt.decision != SamplingDecisionUnknown {
+				if h := DownstreamHeader(ctx); h.SamplingDecision != tt.decision {
+					t.Errorf("want %q, got %q", tt.decision, h.SamplingDecision)
+				}
+			}
+			seg.Close()
+
+			got, err := td.Recv()
+			if !tt.want {
+				if err == nil {
+					t.Error("want timeout, but not")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := map[string]bool{got.Name: true}
+			// the subsegment is emitted after the decision.
+			got, err = td.Recv()
+			if err != nil {
+				t.Fatal(err)
+			}
+			names[got.Name] = true
+			if !names["foobar"] || !names["downstream"] {
+				t.Errorf("unexpected segments: %v", names)
+			}
+		})
+	}
+}
+
+func TestBeginSegment_DeferSamplingDecisionMaxSegments(t *testing.T) {
+	for _, local := range []bool{true, false} {
+		t.Run(fmt.Sprintf("local %t", local), func(t *testing.T) {
+			ctx, td := NewTestDaemon(nil)
+			defer td.Close()
+			if err := ContextClient(ctx).Reconfigure(&Config{
+				DaemonAddress: td.DaemonAddress(),
+				SamplingStrategy: sampling.StrategyFunc(func(req *sampling.Request) *sampling.Decision {
+					return &sampling.Decision{Sample: local}
+				}),
+				DeferSamplingDecision:            true,
+				DeferSamplingDecisionMaxSegments: 3,
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, seg := BeginSegment(ctx, "foobar")
+			for i := range 2 {
+				_, sub := BeginSubsegment(ctx, "downstream")
+				if sub == nil {
+					t.Fatalf("%d: want subsegment, got nil", i)
+				}
+				sub.Close()
+			}
+
+			// the trace exceeds the limit, and the local decision is used.
+			subCtx, sub := BeginSubsegment(ctx, "downstream")
+			want := SamplingDecisionNotSampled
+			if local {
+				want = SamplingDecisionSampled
+			}
+			if h := DownstreamHeader(subCtx); h.SamplingDecision != want {
+				t.Errorf("want %q, got %q", want, h.SamplingDecision)
+			}
+			if (sub != nil) != local {
+				t.Errorf("want the subsegment recorded: %t, got %v", local, sub)
+			}
+			sub.Close()
+			seg.Close()
+
+			got, err := td.Recv()
+			if !local {
+				if err == nil {
+					t.Error("want timeout, but not")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Subsegments) != 3 {
+				t.Errorf("want %d subsegments, got %d", 3, len(got.Subsegments))
+			}
+		})
+	}
+}
+
 func TestBeginSubsegment(t *testing.T) {
 	nowFunc = fixedTime
 	defer func() { nowFunc = time.Now }()
@@ -434,6 +625,40 @@ func TestSegment_SetUser(t *testing.T) {
 	}
 }
 
+func TestAddMetadataToNamespace(t *testing.T) {
+	nowFunc = fixedTime
+	defer func() { nowFunc = time.Now }()
+
+	ctx, td := NewTestDaemon(nil)
+	defer td.Close()
+
+	ctx, seg := BeginSegment(ctx, "foobar")
+	AddMetadataToNamespace(ctx, "namespace", "key", "value")
+	seg.Close()
+
+	got, err := td.Recv()
+	if err != nil {
+		t.Error(err)
+	}
+	want := &schema.Segment{
+		Name:      "foobar",
+		ID:        seg.id,
+		TraceID:   seg.traceID,
+		StartTime: 1000000000,
+		EndTime:   1000000000,
+		Metadata: map[string]any{
+			"namespace": map[string]any{
+				"key": "value",
+			},
+		},
+		Service: ServiceData,
+		AWS:     xrayData,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
 func TestSegment_AddAnnotation(t *testing.T) {
 	nowFunc = fixedTime
 	defer func() { nowFunc = time.Now }()
@@ -499,3 +724,37 @@ func BenchmarkBeginSegmentParallel(b *testing.B) {
 		}
 	})
 }
+
+func TestBeginSegmentWithHeader_ParentBasedStrategy(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   bool
+	}{
+		{name: "parent sampled", header: "Root=1-5e645f3e-1dfad076a177c5ccc5de12f5;Sampled=1", want: true},
+		{name: "parent not sampled", header: "Root=1-5e645f3e-1dfad076a177c5ccc5de12f5;Sampled=0", want: false},
+		{name: "no parent decision", header: "Root=1-5e645f3e-1dfad076a177c5ccc5de12f5", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, td := NewTestDaemon(nil)
+			defer td.Close()
+			if err := ContextClient(ctx).Reconfigure(&Config{
+				DaemonAddress: td.DaemonAddress(),
+				SamplingStrategy: sampling.NewParentBasedStrategy(
+					// the root strategy has no opinion.
+					sampling.NewChainStrategy(),
+				),
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			_, seg := BeginSegmentWithHeader(ctx, "foobar", tt.header)
+			// the segments that are not sampled are dummy.
+			if got := seg != nil; got != tt.want {
+				t.Errorf("want %t, got %t", tt.want, got)
+			}
+			seg.Close()
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package xray
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/shogo82148/aws-xray-yasdk-go/xray/sampling"
+	"github.com/shogo82148/aws-xray-yasdk-go/xray/xraylog"
+)
+
+const (
+	// DefaultTailSamplingMaxTraces is the default value of TailSamplingConfig.MaxTraces.
+	DefaultTailSamplingMaxTraces = 1000
+
+	// DefaultTailSamplingMaxSegmentsPerTrace is the default value of TailSamplingConfig.MaxSegmentsPerTrace.
+	DefaultTailSamplingMaxSegmentsPerTrace = 100
+
+	// DefaultTailSamplingMaxTraceDuration is the default value of TailSamplingConfig.MaxTraceDuration.
+	DefaultTailSamplingMaxTraceDuration = 5 * time.Minute
+)
+
+// TailSamplingConfig is the configure of tail sampling.
+//
+// With tail sampling, the SDK records the traces that SamplingStrategy doesn't sample in memory,
+// and decides whether to emit them when their root segments are closed.
+// A trace is emitted if any segment in the trace has a fault, an error, or a throttle,
+// or if the root segment takes longer than LatencyThreshold.
+// Otherwise, it is discarded. Strategy can customize the decision.
+//
+// The memory for tail sampling is bounded by MaxTraces * MaxSegmentsPerTrace segments,
+// and the metadata of each segment is bounded by Config.MaxMetadataBytesPerSegment.
+// The traces that exceed MaxTraces are not recorded, and the subsegments that exceed MaxSegmentsPerTrace are dropped.
+// The traces whose root segments are not closed in MaxTraceDuration are discarded,
+// so the root segments that are never closed don't exhaust MaxTraces.
+//
+// The traces that the upstream services decided are not recorded.
+// The downstream services receive "Sampled=0" as the decision of the recorded traces,
+// so all services in the trace see the same decision as without tail sampling.
+type TailSamplingConfig struct {
+	// LatencyThreshold is the latency of the root segments to emit the traces.
+	// Zero means that the traces are emitted only on failures.
+	LatencyThreshold time.Duration
+
+	// MaxTraces is the maximum number of the traces recorded at the same time.
+	// Zero means DefaultTailSamplingMaxTraces.
+	MaxTraces int
+
+	// MaxSegmentsPerTrace is the maximum number of the segments and subsegments in a recorded trace.
+	// Zero means DefaultTailSamplingMaxSegmentsPerTrace.
+	MaxSegmentsPerTrace int
+
+	// MaxTraceDuration is the maximum duration to record a trace.
+	// If the root segment is not closed in it, the trace is discarded and its budget is returned.
+	// Zero means DefaultTailSamplingMaxTraceDuration.
+	MaxTraceDuration time.Duration
+
+	// Strategy decides whether to emit the recorded trace when its root segment is closed
+	// and it doesn't exceed LatencyThreshold.
+	// It is asked with the same request as Config.SamplingStrategy,
+	// and [sampling.Request.Error] is set if any segment in the trace has a fault, an error, or a throttle.
+	// e.g. sampling.NewSampleErrorsStrategy(sampling.NewRateLimitStrategy(...)) emits all failed traces,
+	// and some of the successful traces.
+	// If it is nil or has no opinion, the trace is emitted only if it has a failure.
+	//
+	// It is called while the trace is locked, so it must not call the methods of the segments.
+	Strategy sampling.Strategy
+}
+
+type tailSampler struct {
+	latencyThreshold time.Duration
+	maxTraces        int64
+	maxSegments      int
+	maxDuration      time.Duration
+	strategy         sampling.Strategy
+
+	// the number of the traces recorded now.
+	traces atomic.Int64
+}
+
+func newTailSampler(config *TailSamplingConfig) *tailSampler {
+	if config == nil {
+		return nil
+	}
+	maxTraces := config.MaxTraces
+	if maxTraces <= 0 {
+		maxTraces = DefaultTailSamplingMaxTraces
+	}
+	maxSegments := config.MaxSegmentsPerTrace
+	if maxSegments <= 0 {
+		maxSegments = DefaultTailSamplingMaxSegmentsPerTrace
+	}
+	maxDuration := config.MaxTraceDuration
+	if maxDuration <= 0 {
+		maxDuration = DefaultTailSamplingMaxTraceDuration
+	}
+	return &tailSampler{
+		latencyThreshold: config.LatencyThreshold,
+		maxTraces:        int64(maxTraces),
+		maxSegments:      maxSegments,
+		maxDuration:      maxDuration,
+		strategy:         config.Strategy,
+	}
+}
+
+// acquire reserves the memory for a new trace.
+// It returns false if the budget is exhausted.
+func (s *tailSampler) acquire() bool {
+	if s.traces.Add(1) > s.maxTraces {
+		s.traces.Add(-1)
+		return false
+	}
+	return true
+}
+
+// release returns the memory of a trace.
+func (s *tailSampler) release() {
+	s.traces.Add(-1)
+}
+
+// keepLocked returns whether the trace should be emitted.
+// root should be closed, and root.mu should be locked.
+func (s *tailSampler) keepLocked(root *Segment) bool {
+	if s.latencyThreshold > 0 && root.endTime.Sub(root.startTime) > s.latencyThreshold {
+		return true
+	}
+	failed := root.hasFailureLocked()
+	if s.strategy != nil && root.tailRequest != nil {
+		// ask again, now that the outcome of the request is known.
+		req := *root.tailRequest
+		req.Error = failed
+		if sd := s.strategy.ShouldTrace(&req); sd != nil {
+			xraylog.Debugf(root.ctx, "Tail sampling: TailSamplingConfig.Strategy decided: %t by %s", sd.Sample, sd.DecidedBy)
+			return sd.Sample
+		}
+	}
+	return failed
+}
+
+// hasFailureLocked returns whether seg or its subsegments have a fault, an error, or a throttle.
+// seg.mu should be locked.
+func (seg *Segment) hasFailureLocked() bool {
+	if seg.fault || seg.error || seg.throttle {
+		return true
+	}
+	for _, sub := range seg.subsegments {
+		sub.mu.RLock()
+		failed := sub.hasFailureLocked()
+		sub.mu.RUnlock()
+		if failed {
+			return true
+		}
+	}
+	return false
+}
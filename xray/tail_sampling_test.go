@@ -0,0 +1,226 @@
+package xray
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shogo82148/aws-xray-yasdk-go/xray/sampling"
+)
+
+func newTailSamplingDaemon(t *testing.T, config *TailSamplingConfig) (context.Context, *TestDaemon) {
+	t.Helper()
+	ctx, td := NewTestDaemon(nil)
+	if err := ContextClient(ctx).Reconfigure(&Config{
+		DaemonAddress: td.DaemonAddress(),
+		SamplingStrategy: sampling.StrategyFunc(func(req *sampling.Request) *sampling.Decision {
+			return &sampling.Decision{Sample: false}
+		}),
+		StreamingStrategy: NewStreamingStrategyLimitSubsegment(0),
+		TailSampling:      config,
+	}); err != nil {
+		td.Close()
+		t.Fatal(err)
+	}
+	return ctx, td
+}
+
+func TestTailSampling(t *testing.T) {
+	ctx, td := newTailSamplingDaemon(t, &TailSamplingConfig{})
+	defer td.Close()
+
+	// the trace without failures is discarded.
+	ctx1, seg := BeginSegment(ctx, "success")
+	if seg == nil {
+		t.Fatal("want the segment to be recorded, but not")
+	}
+	if got := DownstreamHeader(ctx1).SamplingDecision; got != SamplingDecisionNotSampled {
+		t.Errorf("want %v, got %v", SamplingDecisionNotSampled, got)
+	}
+	_, sub := BeginSubsegment(ctx1, "sub")
+	sub.Close()
+	seg.Close()
+
+	// the trace with a failure in the subsegment is emitted.
+	ctx2, seg := BeginSegment(ctx, "failure")
+	_, sub = BeginSubsegment(ctx2, "sub")
+	sub.AddError(errors.New("something wrong"))
+	sub.Close()
+	seg.Close()
+
+	var names []string
+	for range 2 {
+		got, err := td.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.TraceID != seg.traceID {
+			t.Errorf("unexpected trace id: want %s, got %s", seg.traceID, got.TraceID)
+		}
+		names = append(names, got.Name)
+	}
+	if !(names[0] == "sub" && names[1] == "failure" || names[0] == "failure" && names[1] == "sub") {
+		t.Errorf("unexpected segments: %v", names)
+	}
+	if _, err := td.Recv(); err == nil {
+		t.Error("want no more segments, but got one")
+	}
+}
+
+func TestTailSampling_Latency(t *testing.T) {
+	now := fixedTime()
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = time.Now }()
+
+	ctx, td := newTailSamplingDaemon(t, &TailSamplingConfig{
+		LatencyThreshold: time.Second,
+	})
+	defer td.Close()
+
+	_, seg := BeginSegment(ctx, "fast")
+	now = now.Add(time.Second)
+	seg.Close()
+
+	_, seg = BeginSegment(ctx, "slow")
+	now = now.Add(2 * time.Second)
+	seg.Close()
+
+	got, err := td.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "slow" {
+		t.Errorf("want %q, got %q", "slow", got.Name)
+	}
+}
+
+func TestTailSampling_Limits(t *testing.T) {
+	ctx, td := newTailSamplingDaemon(t, &TailSamplingConfig{
+		MaxTraces:           1,
+		MaxSegmentsPerTrace: 2,
+	})
+	defer td.Close()
+
+	ctx1, seg1 := BeginSegment(ctx, "first")
+	if seg1 == nil {
+		t.Fatal("want the segment to be recorded, but not")
+	}
+
+	// the budget is exhausted.
+	_, seg2 := BeginSegment(ctx, "second")
+	if seg2 != nil {
+		t.Error("want the segment not to be recorded, but recorded")
+	}
+
+	_, sub1 := BeginSubsegment(ctx1, "sub1")
+	if sub1 == nil {
+		t.Fatal("want the subsegment to be recorded, but not")
+	}
+	_, sub2 := BeginSubsegment(ctx1, "sub2")
+	if sub2 != nil {
+		t.Error("want the subsegment to be dropped, but not")
+	}
+	sub1.Close()
+	seg1.Close()
+
+	// the budget is returned.
+	_, seg3 := BeginSegment(ctx, "third")
+	if seg3 == nil {
+		t.Fatal("want the segment to be recorded, but not")
+	}
+	seg3.Close()
+}
+
+func TestTailSampling_MaxTraceDuration(t *testing.T) {
+	ctx, td := newTailSamplingDaemon(t, &TailSamplingConfig{
+		MaxTraces:        1,
+		MaxTraceDuration: 10 * time.Millisecond,
+	})
+	defer td.Close()
+
+	// the root segment that is never closed.
+	ctx1, seg1 := BeginSegment(ctx, "leaked")
+	if seg1 == nil {
+		t.Fatal("want the segment to be recorded, but not")
+	}
+
+	// the budget is returned after MaxTraceDuration.
+	var seg2 *Segment
+	for range 100 {
+		time.Sleep(10 * time.Millisecond)
+		if _, seg2 = BeginSegment(ctx, "second"); seg2 != nil {
+			break
+		}
+	}
+	if seg2 == nil {
+		t.Fatal("want the segment to be recorded, but not")
+	}
+	seg2.AddError(errors.New("something wrong"))
+	seg2.Close()
+
+	got, err := td.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "second" {
+		t.Errorf("want %q, got %q", "second", got.Name)
+	}
+
+	// the expired trace is discarded even if it fails.
+	_, sub := BeginSubsegment(ctx1, "sub")
+	sub.AddError(errors.New("something wrong"))
+	sub.Close()
+	seg1.Close()
+	if _, err := td.Recv(); err == nil {
+		t.Error("want no more segments, but got one")
+	}
+}
+
+func TestTailSampling_UpstreamDecided(t *testing.T) {
+	ctx, td := newTailSamplingDaemon(t, &TailSamplingConfig{})
+	defer td.Close()
+
+	_, seg := BeginSegmentWithHeader(ctx, "foobar", "Root=1-5e645f3e-1dfad076a177c5ccc5de12f5;Sampled=0")
+	if seg != nil {
+		t.Error("want the segment not to be recorded, but recorded")
+	}
+}
+
+func TestTailSampling_Strategy(t *testing.T) {
+	ctx, td := newTailSamplingDaemon(t, &TailSamplingConfig{
+		Strategy: sampling.NewSampleErrorsStrategy(sampling.StrategyFunc(func(req *sampling.Request) *sampling.Decision {
+			if req.Error {
+				t.Error("want the successful request, but it failed")
+			}
+			return &sampling.Decision{Sample: req.ServiceName == "lucky"}
+		})),
+	})
+	defer td.Close()
+
+	// the successful traces are decided by the strategy.
+	_, seg := BeginSegment(ctx, "ordinary")
+	seg.Close()
+	_, seg = BeginSegment(ctx, "lucky")
+	seg.Close()
+
+	// the failed traces are always emitted.
+	_, seg = BeginSegment(ctx, "failure")
+	seg.SetFault()
+	seg.Close()
+
+	var names []string
+	for range 2 {
+		got, err := td.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, got.Name)
+	}
+	if !(names[0] == "lucky" && names[1] == "failure") {
+		t.Errorf("unexpected segments: %v", names)
+	}
+	if _, err := td.Recv(); err == nil {
+		t.Error("want no more segments, but got one")
+	}
+}
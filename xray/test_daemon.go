@@ -24,6 +24,8 @@ type TestDaemon struct {
 	ContextMissing func(ctx context.Context, v any)
 
 	ch        <-chan *result
+	client    *Client
+	address   string
 	conn      net.PacketConn
 	ctx       context.Context
 	cancel    context.CancelFunc
@@ -57,11 +59,13 @@ func NewTestDaemon(handler http.Handler) (context.Context, *TestDaemon) {
 		address += " tcp:" + u.Host
 	}
 
-	ctx = context.WithValue(ctx, clientContextKey, New(&Config{
+	d.address = address
+	d.client = New(&Config{
 		DaemonAddress:          address,
 		SamplingStrategy:       sampling.NewAllStrategy(),
 		ContextMissingStrategy: &testDaemonContextMissing{td: d},
-	}))
+	})
+	ctx = context.WithValue(ctx, clientContextKey, d.client)
 
 	go d.run(c)
 	return ctx, d
@@ -82,10 +86,17 @@ type result struct {
 	Error   error
 }
 
+// DaemonAddress returns the address of the daemon in the format of Config.DaemonAddress.
+// It is useful for reconfiguring the client of the daemon.
+func (td *TestDaemon) DaemonAddress() string {
+	return td.address
+}
+
 // Close shutdowns the daemon.
 func (td *TestDaemon) Close() {
 	td.closeOnce.Do(func() {
 		td.cancel()
+		td.client.Close()
 		td.conn.Close()
 		if td.ts != nil {
 			td.ts.Close()
@@ -142,6 +153,7 @@ func (td *TestDaemon) Recv() (*schema.Segment, error) {
 
 // NullDaemon receives segment documents, but ignore them.
 type NullDaemon struct {
+	client    *Client
 	conn      net.PacketConn
 	ctx       context.Context
 	cancel    context.CancelFunc
@@ -164,11 +176,12 @@ func NewNullDaemon() (context.Context, *NullDaemon) {
 	}
 	address := "udp:" + conn.LocalAddr().String()
 
-	ctx = context.WithValue(ctx, clientContextKey, New(&Config{
+	d.client = New(&Config{
 		DaemonAddress:          address,
 		SamplingStrategy:       sampling.NewAllStrategy(),
 		ContextMissingStrategy: &ctxmissing.LogErrorStrategy{},
-	}))
+	})
+	ctx = context.WithValue(ctx, clientContextKey, d.client)
 
 	go d.run()
 	return ctx, d
@@ -190,6 +203,7 @@ func (td *NullDaemon) run() {
 func (td *NullDaemon) Close() {
 	td.closeOnce.Do(func() {
 		td.cancel()
+		td.client.Close()
 		td.conn.Close()
 	})
 }
@@ -0,0 +1,31 @@
+package xray
+
+import "time"
+
+// maxTimings is the maximum number of the timings that a segment records.
+const maxTimings = 64
+
+// Timing is the duration of a subsegment.
+type Timing struct {
+	Name     string
+	Duration time.Duration
+}
+
+// Timings returns the durations of the subsegments that are direct children of the root segment,
+// in the order of closing. The subsegments in progress are not included.
+// It returns nil unless the root segment begins with [WithTimings].
+// At most 64 timings are recorded.
+func (seg *Segment) Timings() []Timing {
+	if seg == nil {
+		return nil
+	}
+	root := seg.root
+	root.mu.RLock()
+	defer root.mu.RUnlock()
+	if len(root.timings) == 0 {
+		return nil
+	}
+	ret := make([]Timing, len(root.timings))
+	copy(ret, root.timings)
+	return ret
+}
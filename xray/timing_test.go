@@ -0,0 +1,55 @@
+package xray
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSegment_Timings(t *testing.T) {
+	ctx, td := NewTestDaemon(nil)
+	defer td.Close()
+
+	ctx, root := BeginSegmentWithOptions(ctx, "root", WithTimings())
+	ctx1, seg1 := BeginSubsegment(ctx, "db")
+	_, seg2 := BeginSubsegment(ctx1, "nested")
+	seg2.Close()
+	seg1.Close()
+	_, seg3 := BeginSubsegment(ctx, "in progress")
+
+	var names []string
+	for _, timing := range root.Timings() {
+		names = append(names, timing.Name)
+		if timing.Duration < 0 {
+			t.Errorf("%s: want non-negative duration, got %s", timing.Name, timing.Duration)
+		}
+	}
+	// the nested subsegments and the subsegments in progress are not included.
+	if diff := cmp.Diff([]string{"db"}, names); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	seg3.Close()
+	root.Close()
+	if _, err := td.Recv(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSegment_Timings_Disabled(t *testing.T) {
+	ctx, td := NewTestDaemon(nil)
+	defer td.Close()
+
+	ctx, root := BeginSegment(ctx, "root")
+	_, seg := BeginSubsegment(ctx, "db")
+	seg.Close()
+	if timings := root.Timings(); timings != nil {
+		t.Errorf("want nil, got %v", timings)
+	}
+	root.Close()
+
+	var nilSegment *Segment
+	if timings := nilSegment.Timings(); timings != nil {
+		t.Errorf("want nil, got %v", timings)
+	}
+}
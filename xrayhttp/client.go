@@ -95,6 +95,12 @@ func (rt *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 		responseInfo.ContentLength = length
 	}
 	seg.SetHTTPResponse(responseInfo)
+
+	// the downstream service may decide the sampling decision that we deferred.
+	if h := xray.ParseTraceHeader(resp.Header.Get(xray.TraceIDHeaderKey)); h.TraceID == "" || h.TraceID == xray.ContextTraceID(ctx) {
+		seg.ResolveSamplingDecision(h.SamplingDecision)
+	}
+
 	if resp.StatusCode >= 400 && resp.StatusCode < 500 {
 		seg.SetError()
 	}
@@ -17,6 +17,7 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/shogo82148/aws-xray-yasdk-go/xray"
+	"github.com/shogo82148/aws-xray-yasdk-go/xray/sampling"
 	"github.com/shogo82148/aws-xray-yasdk-go/xray/schema"
 )
 
@@ -1364,3 +1365,58 @@ func TestClient_UnexpectedEOF(t *testing.T) {
 		t.Errorf("invalid parent id, want %s, got %s", got.ID, traceHeader.ParentID)
 	}
 }
+
+func TestClient_DeferSamplingDecision(t *testing.T) {
+	ctx, td := xray.NewTestDaemon(nil)
+	defer td.Close()
+	if err := xray.ContextClient(ctx).Reconfigure(&xray.Config{
+		DaemonAddress: td.DaemonAddress(),
+		SamplingStrategy: sampling.StrategyFunc(func(req *sampling.Request) *sampling.Decision {
+			return &sampling.Decision{Sample: false}
+		}),
+		DeferSamplingDecision: true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the downstream service decides the sampling decision.
+	downstreamCtx, nd := xray.NewNullDaemon()
+	defer nd.Close()
+	downstream := xray.ContextClient(downstreamCtx)
+	ts := httptest.NewServer(HandlerWithClient(FixedTracingNamer("downstream"), downstream, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	})))
+	defer ts.Close()
+
+	func() {
+		client := Client(nil)
+		ctx, root := xray.BeginSegment(ctx, "test")
+		defer root.Close()
+		if xray.DownstreamHeader(ctx).SamplingDecision != xray.SamplingDecisionRequested {
+			t.Error("want the sampling decision to be requested, but not")
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+			t.Fatal(err)
+		}
+		if xray.DownstreamHeader(ctx).SamplingDecision != xray.SamplingDecisionSampled {
+			t.Error("want the trace to be sampled, but not")
+		}
+	}()
+
+	got, err := td.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "test" {
+		t.Errorf("want %q, got %q", "test", got.Name)
+	}
+}
@@ -11,6 +11,16 @@
 //	}))
 //	http.ListenAndServe(":8080", h)
 //
+// [HandlerWithOptions] accepts [HandlerOption]s to customize the tracing.
+// If the wrapped handler is [net/http.ServeMux], the pattern of the matched route is recorded as an annotation.
+//
+//	mux := http.NewServeMux()
+//	mux.HandleFunc("GET /users/{id}", getUser)
+//	h := xrayhttp.HandlerWithOptions(namer, mux, xrayhttp.WithRouteSampling())
+//
+// The segment is closed when the handler hijacks the connection, e.g. for WebSocket.
+// [WithHijackTracing] keeps a subsegment open until the hijacked connection is closed.
+//
 // # HTTP Client
 //
 // [Client] wraps the provided [net/http.Client].
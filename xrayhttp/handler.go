@@ -8,6 +8,8 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/shogo82148/aws-xray-yasdk-go/xray"
 	"github.com/shogo82148/aws-xray-yasdk-go/xray/sampling"
@@ -54,6 +56,46 @@ type httpTracer struct {
 	tn     TracingNamer
 	client *xray.Client
 	h      http.Handler
+
+	// routeSampling makes the sampling rules match the route pattern.
+	routeSampling bool
+
+	// routeSubsegment wraps the handler of the route in a subsegment named by the route pattern.
+	routeSubsegment bool
+
+	// the canonical names of the headers to record.
+	requestHeaders  []string
+	responseHeaders []string
+
+	// recordQuery records the query string in the URL.
+	recordQuery bool
+
+	// the names of the query parameters whose values are redacted.
+	redactedParams map[string]struct{}
+
+	// annotators return the annotations of the request.
+	annotators []func(r *http.Request) map[string]any
+
+	// the patterns of the paths that are not traced.
+	skipPaths []string
+
+	// traceIDResponseHeader writes the trace ID to the X-Amzn-Trace-Id response header.
+	traceIDResponseHeader bool
+
+	// serverTiming writes the durations of the subsegments to the Server-Timing response header.
+	serverTiming bool
+
+	// requestBody traces reading the request body.
+	requestBody bool
+
+	// flushTiming records the timings of the flushes of the response.
+	flushTiming bool
+
+	// hijackTracing traces the hijacked connections until they are closed.
+	hijackTracing bool
+
+	// webSocketFrames records the WebSocket frames on the hijacked connections.
+	webSocketFrames bool
 }
 
 // Handler wraps the provided [net/http.Handler].
@@ -75,8 +117,26 @@ func HandlerWithClient(tn TracingNamer, client *xray.Client, h http.Handler) htt
 	}
 }
 
+// HandlerWithOptions wraps the provided [net/http.Handler] with the options.
+// The returned [net/http.Handler] creates a sub-segment and collects information of the request.
+//
+// If the request is routed by [net/http.ServeMux] in Go 1.22 or later,
+// the matched pattern is recorded as the "http_route" annotation, e.g. "GET /users/{id}",
+// so the requests to the same route are grouped together.
+func HandlerWithOptions(tn TracingNamer, h http.Handler, opts ...HandlerOption) http.Handler {
+	tracer := &httpTracer{
+		tn: tn,
+		h:  h,
+	}
+	for _, opt := range opts {
+		opt(tracer)
+	}
+	return tracer
+}
+
 // ServeHTTP implements [net/http.Handler].
 func (tracer *httpTracer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
 	name := tracer.tn.TracingName(r)
 	if name == "" {
 		name = os.Getenv("AWS_XRAY_TRACING_NAME")
@@ -88,31 +148,106 @@ func (tracer *httpTracer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if tracer.client != nil {
 		ctx = xray.WithClient(ctx, tracer.client)
 	}
-	ctx, seg := xray.BeginSegmentWithRequest(ctx, name, r)
+
+	// find the route before the handler runs, if the options need it.
+	var pattern string
+	if tracer.routeSampling || tracer.routeSubsegment {
+		if resolver, ok := tracer.h.(routeResolver); ok {
+			_, pattern = resolver.Handler(r)
+		}
+	}
+
+	opts := []xray.SegmentOption{xray.WithHTTPRequest(r)}
+	if tracer.routeSampling && pattern != "" {
+		opts = append(opts, xray.WithPath(routePath(pattern)))
+	}
+	if tracer.skip(r) {
+		// the downstream services don't trace the request either.
+		opts = append(opts, xray.WithSampled(false))
+	}
+	if tracer.serverTiming {
+		opts = append(opts, xray.WithTimings())
+	}
+	ctx, seg := xray.BeginSegmentWithOptions(ctx, name, opts...)
 	r = r.WithContext(ctx)
 
+	// the upstream service requested the sampling decision, so tell it in the response.
+	if h, ok := xray.ResponseTraceHeader(ctx); ok {
+		w.Header().Set(xray.TraceIDHeaderKey, h.String())
+	}
+
 	ip, forwarded := clientIP(r)
 	requestInfo := &schema.HTTPRequest{
 		Method:        r.Method,
-		URL:           getURL(r),
+		URL:           tracer.getURL(r),
 		ClientIP:      ip,
 		XForwardedFor: forwarded,
 		UserAgent:     r.UserAgent(),
 	}
 	seg.SetHTTPRequest(requestInfo)
+	if seg != nil {
+		if headers := captureHeaders(r.Header, tracer.requestHeaders); headers != nil {
+			seg.AddMetadataToNamespace(metadataNamespace, "request_headers", headers)
+		}
+		for _, annotator := range tracer.annotators {
+			seg.AddAnnotations(annotator(r))
+		}
+	}
 
-	rw := &serverResponseTracer{rw: w, ctx: ctx, seg: seg}
+	rw := &serverResponseTracer{
+		rw:              w,
+		ctx:             ctx,
+		seg:             seg,
+		flushTiming:     tracer.flushTiming,
+		hijackTracing:   tracer.hijackTracing,
+		webSocketFrames: tracer.webSocketFrames,
+	}
+	if tracer.traceIDResponseHeader || tracer.serverTiming {
+		rw.beforeWriteHeader = func(h http.Header) {
+			tracer.writeResponseHeaders(h, ctx, seg, start)
+		}
+	}
+	recordRoute := func() {
+		// ServeMux sets the pattern of the route that matches the request.
+		if r.Pattern != "" {
+			pattern = r.Pattern
+		}
+		if pattern != "" {
+			routeAnnotation.AddToSegment(seg, pattern)
+		}
+	}
+	// the segment is closed when the connection is hijacked, so record the route before it.
+	rw.beforeHijack = recordRoute
 	defer rw.close()
-	tracer.h.ServeHTTP(wrap(rw), r)
+	if tracer.requestBody && r.Body != nil && r.Body != http.NoBody {
+		body := &serverRequestTracer{BaseContext: ctx, root: seg, body: r.Body}
+		defer body.finish()
+		r.Body = body
+	}
+	if tracer.routeSubsegment && pattern != "" {
+		tracer.serveRoute(wrap(rw), r, pattern)
+	} else {
+		tracer.h.ServeHTTP(wrap(rw), r)
+	}
+	if rw.status == 0 && !rw.hijacked {
+		// the handler wrote nothing, and net/http writes the headers of the implicit 200 response after it returns.
+		rw.callBeforeWriteHeader()
+	}
 	if rw.hijacked {
 		return
 	}
+	recordRoute()
 
 	responseInfo := &schema.HTTPResponse{
 		Status:        rw.status,
 		ContentLength: rw.size,
 	}
 	seg.SetHTTPResponse(responseInfo)
+	if seg != nil {
+		if headers := captureHeaders(w.Header(), tracer.responseHeaders); headers != nil {
+			seg.AddMetadataToNamespace(metadataNamespace, "response_headers", headers)
+		}
+	}
 
 	// Set error flag if http connection is already closed by client.
 	select {
@@ -133,6 +268,64 @@ func (tracer *httpTracer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// serveRoute serves the request in the subsegment of the route.
+func (tracer *httpTracer) serveRoute(w http.ResponseWriter, r *http.Request, pattern string) {
+	ctx, seg := xray.BeginSubsegment(r.Context(), routeSegmentName(pattern))
+	defer func() {
+		if err := recover(); err != nil {
+			seg.AddPanic(err)
+			seg.Close()
+			panic(err)
+		}
+		seg.Close()
+	}()
+	tracer.h.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// routeAnnotation is the annotation for the route pattern.
+var routeAnnotation = xray.NewAnnotationKey[string]("http_route")
+
+// routeResolver finds the handler and the pattern of the route.
+// [*net/http.ServeMux] implements it.
+type routeResolver interface {
+	Handler(r *http.Request) (h http.Handler, pattern string)
+}
+
+// routePath returns the path of the pattern of [net/http.ServeMux].
+// The pattern is formatted as "[METHOD ][HOST]/[PATH]".
+func routePath(pattern string) string {
+	if _, rest, ok := strings.Cut(pattern, " "); ok {
+		pattern = strings.TrimLeft(rest, " \t")
+	}
+	if i := strings.IndexByte(pattern, '/'); i >= 0 {
+		return pattern[i:]
+	}
+	return pattern
+}
+
+// routeSegmentName converts the pattern into a valid segment name.
+// e.g. "GET /users/{id}" is converted into "GET /users/:id".
+var routeSegmentName = strings.NewReplacer("{$}", "", "{", ":", "}", "").Replace
+
+// getURL returns the URL of the request to record.
+func (tracer *httpTracer) getURL(r *http.Request) string {
+	u := getURL(r)
+	if tracer.recordQuery && r.URL.RawQuery != "" {
+		u += "?" + redactQuery(r.URL.RawQuery, tracer.redactedParams)
+	}
+	return u
+}
+
+// skip returns whether the request is not traced.
+func (tracer *httpTracer) skip(r *http.Request) bool {
+	for _, pattern := range tracer.skipPaths {
+		if sampling.WildcardMatch(pattern, r.URL.Path, false) {
+			return true
+		}
+	}
+	return false
+}
+
 func getURL(r *http.Request) string {
 	forwarded, err := forwardedheader.Parse(r.Header.Values("Forwarded"))
 	if err == nil && len(forwarded) > 0 {
@@ -218,6 +411,39 @@ type serverResponseTracer struct {
 	status   int
 	size     int64
 	hijacked bool
+
+	// beforeWriteHeader is called with the response headers once before the headers are written.
+	beforeWriteHeader func(h http.Header)
+
+	// beforeHijack is called before the segment is closed by hijacking.
+	beforeHijack func()
+
+	// flushTiming records the timings of the flushes.
+	flushTiming bool
+	respStart   time.Time
+	flushes     []flushTiming
+	flushCount  int
+	flushedSize int64
+
+	// hijackTracing traces the hijacked connection.
+	hijackTracing   bool
+	webSocketFrames bool
+}
+
+// maxFlushTimings is the maximum number of the flushes whose timings are recorded.
+// The streaming responses, e.g. Server-Sent Events, may flush many times.
+const maxFlushTimings = 100
+
+// flushTiming is the timing of a flush of the response.
+type flushTiming struct {
+	// Offset is the time in seconds from the beginning of the response.
+	Offset float64 `json:"offset"`
+
+	// Duration is the time in seconds that the flush takes.
+	Duration float64 `json:"duration"`
+
+	// Bytes is the size of the response body written since the previous flush.
+	Bytes int64 `json:"bytes"`
 }
 
 // Header implements [net/http.ResponseWriter].
@@ -237,11 +463,23 @@ func (rw *serverResponseTracer) Write(b []byte) (int, error) {
 
 // WriteHeader implements [net/http.ResponseWriter].
 func (rw *serverResponseTracer) WriteHeader(s int) {
+	rw.callBeforeWriteHeader()
 	if rw.respCtx == nil {
 		rw.respCtx, rw.respSeg = xray.BeginSubsegment(rw.ctx, "response")
 	}
 	rw.rw.WriteHeader(s)
 	rw.status = s
+	if rw.respStart.IsZero() {
+		rw.respStart = time.Now()
+	}
+}
+
+// callBeforeWriteHeader calls beforeWriteHeader once.
+func (rw *serverResponseTracer) callBeforeWriteHeader() {
+	if f := rw.beforeWriteHeader; f != nil {
+		rw.beforeWriteHeader = nil
+		f(rw.rw.Header())
+	}
 }
 
 // Hijack implements [net/http.Hijacker].
@@ -260,6 +498,13 @@ func (rw *serverResponseTracer) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 			ContentLength: rw.size,
 		}
 		rw.seg.SetHTTPResponse(responseInfo)
+		if rw.beforeHijack != nil {
+			rw.beforeHijack()
+		}
+		if rw.hijackTracing {
+			// the subsegment of the connection outlives the segment.
+			conn, buf = traceConn(rw.ctx, conn, buf, rw.webSocketFrames)
+		}
 		rw.close()
 	}
 	return conn, buf, err
@@ -267,9 +512,26 @@ func (rw *serverResponseTracer) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 
 // Flush implements [net/http.Flusher].
 func (rw *serverResponseTracer) Flush() {
+	if rw.status == 0 {
+		rw.WriteHeader(http.StatusOK)
+	}
 	// we don't check rw.rw actually implements http.Flusher here, because it is done in the wrap func.
 	f := rw.rw.(http.Flusher)
+	if !rw.flushTiming {
+		f.Flush()
+		return
+	}
+	start := time.Now()
 	f.Flush()
+	rw.flushCount++
+	if len(rw.flushes) < maxFlushTimings {
+		rw.flushes = append(rw.flushes, flushTiming{
+			Offset:   start.Sub(rw.respStart).Seconds(),
+			Duration: time.Since(start).Seconds(),
+			Bytes:    rw.size - rw.flushedSize,
+		})
+	}
+	rw.flushedSize = rw.size
 }
 
 // Push implements [net/http.Pusher].
@@ -289,6 +551,9 @@ func (rw *serverResponseTracer) CloseNotify() <-chan bool {
 func (rw *serverResponseTracer) WriteString(str string) (int, error) {
 	// we don't check rw.rw actually implements io.StringWriter here, because it is done in the wrap func.
 	s := rw.rw.(io.StringWriter)
+	if rw.status == 0 {
+		rw.WriteHeader(http.StatusOK)
+	}
 	size, err := s.WriteString(str)
 	rw.size += int64(size)
 	return size, err
@@ -298,6 +563,9 @@ func (rw *serverResponseTracer) WriteString(str string) (int, error) {
 func (rw *serverResponseTracer) ReadFrom(src io.Reader) (int64, error) {
 	// we don't check rw.rw actually implements io.ReaderFrom here, because it is done in the wrap func.
 	r := rw.rw.(io.ReaderFrom)
+	if rw.status == 0 {
+		rw.WriteHeader(http.StatusOK)
+	}
 	size, err := r.ReadFrom(src)
 	rw.size += size
 	return size, err
@@ -315,6 +583,10 @@ func (rw *serverResponseTracer) close() {
 		if err != nil {
 			rw.respSeg.SetFault()
 		}
+		if rw.flushCount > 0 {
+			rw.respSeg.AddMetadataToNamespace(metadataNamespace, "flush_count", rw.flushCount)
+			rw.respSeg.AddMetadataToNamespace(metadataNamespace, "flushes", rw.flushes)
+		}
 		rw.respSeg.Close()
 		rw.respCtx, rw.respSeg = nil, nil
 	}
@@ -327,3 +599,73 @@ func (rw *serverResponseTracer) close() {
 		panic(err)
 	}
 }
+
+// serverRequestTracer traces reading the request body.
+// It begins the "request" subsegment when the handler starts reading,
+// and closes it when the handler reaches the end of the body or closes it.
+type serverRequestTracer struct {
+	BaseContext context.Context
+	root        *xray.Segment
+
+	mu           sync.Mutex
+	body         io.ReadCloser
+	ctx          context.Context
+	seg          *xray.Segment
+	size         int64
+	readDuration time.Duration
+	done         bool
+}
+
+// Read implements [io.Reader].
+func (r *serverRequestTracer) Read(b []byte) (int, error) {
+	r.mu.Lock()
+	if r.ctx == nil && !r.done {
+		r.ctx, r.seg = xray.BeginSubsegment(r.BaseContext, "request")
+	}
+	r.mu.Unlock()
+
+	start := time.Now()
+	n, err := r.body.Read(b)
+	elapsed := time.Since(start)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.size += int64(n)
+	r.readDuration += elapsed
+	if err != nil {
+		if err != io.EOF && r.seg != nil {
+			// the client aborted the upload, or the body is broken.
+			r.seg.AddMetadataToNamespace(metadataNamespace, "error", err.Error())
+			r.seg.SetError()
+			r.root.SetError()
+		}
+		r.closeLocked()
+	}
+	return n, err
+}
+
+// Close implements [io.Closer].
+func (r *serverRequestTracer) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closeLocked()
+	return r.body.Close()
+}
+
+// finish closes the subsegment if the handler returns before it reaches the end of the body.
+func (r *serverRequestTracer) finish() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closeLocked()
+}
+
+func (r *serverRequestTracer) closeLocked() {
+	r.done = true
+	if r.ctx == nil {
+		return
+	}
+	r.seg.AddMetadataToNamespace(metadataNamespace, "bytes_read", r.size)
+	r.seg.AddMetadataToNamespace(metadataNamespace, "read_duration", r.readDuration.Seconds())
+	r.seg.Close()
+	r.ctx, r.seg = nil, nil
+}
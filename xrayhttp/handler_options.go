@@ -0,0 +1,276 @@
+package xrayhttp
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shogo82148/aws-xray-yasdk-go/xray"
+)
+
+// metadataNamespace is the namespace of the metadata that the handler records.
+const metadataNamespace = "http"
+
+// redacted replaces the values of the redacted query parameters.
+const redacted = "REDACTED"
+
+// HandlerOption is an option of HandlerWithOptions.
+type HandlerOption func(*httpTracer)
+
+// WithClient configures the client that records the segments.
+// By default, the client in the context of the request is used.
+func WithClient(client *xray.Client) HandlerOption {
+	return func(tracer *httpTracer) {
+		tracer.client = client
+	}
+}
+
+// WithRouteSampling makes the sampling rules match the path of the route pattern, e.g. "/users/{id}",
+// instead of the path of the request, e.g. "/users/123".
+// It works if the wrapped handler is a [*net/http.ServeMux].
+func WithRouteSampling() HandlerOption {
+	return func(tracer *httpTracer) {
+		tracer.routeSampling = true
+	}
+}
+
+// WithRouteSubsegment wraps the handler of the route in a subsegment named by the route pattern,
+// e.g. "GET /users/:id" for the pattern "GET /users/{id}".
+// It works if the wrapped handler is a [*net/http.ServeMux].
+func WithRouteSubsegment() HandlerOption {
+	return func(tracer *httpTracer) {
+		tracer.routeSubsegment = true
+	}
+}
+
+// WithRequestHeaders records the values of the request headers as the "request_headers" metadata in the "http" namespace.
+// The other headers are not recorded, because they may contain secrets such as credentials.
+func WithRequestHeaders(names ...string) HandlerOption {
+	return func(tracer *httpTracer) {
+		for _, name := range names {
+			tracer.requestHeaders = append(tracer.requestHeaders, http.CanonicalHeaderKey(name))
+		}
+	}
+}
+
+// WithResponseHeaders records the values of the response headers as the "response_headers" metadata in the "http" namespace.
+// The other headers are not recorded.
+func WithResponseHeaders(names ...string) HandlerOption {
+	return func(tracer *httpTracer) {
+		for _, name := range names {
+			tracer.responseHeaders = append(tracer.responseHeaders, http.CanonicalHeaderKey(name))
+		}
+	}
+}
+
+// WithQueryString records the query string in the URL of the request.
+// The values of the parameters in redactedParams are replaced with "REDACTED".
+// By default, the query string is not recorded, because it may contain secrets such as tokens.
+func WithQueryString(redactedParams ...string) HandlerOption {
+	return func(tracer *httpTracer) {
+		tracer.recordQuery = true
+		if tracer.redactedParams == nil {
+			tracer.redactedParams = make(map[string]struct{}, len(redactedParams))
+		}
+		for _, name := range redactedParams {
+			tracer.redactedParams[name] = struct{}{}
+		}
+	}
+}
+
+// WithAnnotations adds the annotations that f returns for each request.
+// f is not called for the requests that are not sampled.
+func WithAnnotations(f func(r *http.Request) map[string]any) HandlerOption {
+	return func(tracer *httpTracer) {
+		tracer.annotators = append(tracer.annotators, f)
+	}
+}
+
+// WithHeaderAnnotation records the value of the request header as the annotation.
+// e.g. WithHeaderAnnotation("tenant", "X-Tenant-Id")
+// Nothing is recorded if the request doesn't have the header.
+func WithHeaderAnnotation(key, header string) HandlerOption {
+	return WithAnnotations(func(r *http.Request) map[string]any {
+		value := r.Header.Get(header)
+		if value == "" {
+			return nil
+		}
+		return map[string]any{key: value}
+	})
+}
+
+// WithSkipPaths doesn't trace the requests whose path match the patterns, e.g. "/healthz".
+// The patterns may contain wildcards "*" and "?", and they are case-sensitive.
+// The skipped requests are propagated as not sampled to the downstream services.
+func WithSkipPaths(patterns ...string) HandlerOption {
+	return func(tracer *httpTracer) {
+		tracer.skipPaths = append(tracer.skipPaths, patterns...)
+	}
+}
+
+// WithTraceIDResponseHeader writes the trace ID and the sampling decision to the X-Amzn-Trace-Id response header,
+// e.g. "Root=1-5759e988-bd862e3fe1be46a994272793;Sampled=1",
+// so the clients can report the trace ID of the failed requests.
+func WithTraceIDResponseHeader() HandlerOption {
+	return func(tracer *httpTracer) {
+		tracer.traceIDResponseHeader = true
+	}
+}
+
+// WithServerTiming writes the Server-Timing response header,
+// e.g. "db;dur=12.345, total;dur=15.678".
+// It contains the durations of the subsegments directly under the segment
+// that are closed before the response headers are written,
+// and the "total" duration of the handler until then.
+//
+// The header reveals the internals of the service, so it should be enabled only for the trusted clients.
+func WithServerTiming() HandlerOption {
+	return func(tracer *httpTracer) {
+		tracer.serverTiming = true
+	}
+}
+
+// WithRequestBody traces reading the request body in the "request" subsegment.
+// The subsegment records the size of the body as the "bytes_read" metadata,
+// and the time spent reading it in seconds as the "read_duration" metadata.
+// If the client aborts the upload, the subsegment and the segment are marked as an error.
+func WithRequestBody() HandlerOption {
+	return func(tracer *httpTracer) {
+		tracer.requestBody = true
+	}
+}
+
+// WithFlushTiming records the timings of the flushes of the streaming responses, e.g. Server-Sent Events.
+// The "response" subsegment records the number of the flushes as the "flush_count" metadata,
+// and the offset, the duration and the written bytes of the first 100 flushes as the "flushes" metadata.
+func WithFlushTiming() HandlerOption {
+	return func(tracer *httpTracer) {
+		tracer.flushTiming = true
+	}
+}
+
+// WithHijackTracing traces the connections hijacked by the handler, e.g. WebSocket sessions.
+// The segment is closed when the connection is hijacked as usual,
+// and the "connection" subsegment is kept open until the connection is closed.
+// The subsegment records the number of the bytes received and sent as the "bytes_in" and "bytes_out" metadata,
+// and why the connection is closed as the "close_reason" metadata.
+// The subsegment is closed after the segment is emitted, so it is emitted on its own.
+// It needs a streaming strategy that emits the subsegments separately,
+// such as the default [xray.NewStreamingStrategyLimitSubsegment].
+// It is dropped with [xray.NewStreamingStrategyBatchAll].
+func WithHijackTracing() HandlerOption {
+	return func(tracer *httpTracer) {
+		tracer.hijackTracing = true
+	}
+}
+
+// WithWebSocketFrames enables [WithHijackTracing], and records the WebSocket frames on the hijacked connections.
+// The "connection" subsegment records the number of the frames as the "frames_in" and "frames_out" metadata,
+// the offset, the direction, the opcode and the length of the first 100 frames as the "frames" metadata,
+// and the status code of the close frame as the "close_code" metadata.
+// The payloads of the frames are not recorded.
+func WithWebSocketFrames() HandlerOption {
+	return func(tracer *httpTracer) {
+		tracer.hijackTracing = true
+		tracer.webSocketFrames = true
+	}
+}
+
+// writeResponseHeaders writes the headers of the options before the response headers are written.
+func (tracer *httpTracer) writeResponseHeaders(h http.Header, ctx context.Context, seg *xray.Segment, start time.Time) {
+	if tracer.traceIDResponseHeader && h.Get(xray.TraceIDHeaderKey) == "" {
+		// the header for the upstream service requesting the sampling decision is already set.
+		if traceID := xray.ContextTraceID(ctx); traceID != "" {
+			header := xray.TraceHeader{
+				TraceID:          traceID,
+				SamplingDecision: xray.SamplingDecisionNotSampled,
+			}
+			if seg.Sampled() {
+				header.SamplingDecision = xray.SamplingDecisionSampled
+			}
+			h.Set(xray.TraceIDHeaderKey, header.String())
+		}
+	}
+	if tracer.serverTiming {
+		timings := seg.Timings()
+		timings = append(timings, xray.Timing{Name: "total", Duration: time.Since(start)})
+		h.Add("Server-Timing", formatServerTiming(timings))
+	}
+}
+
+// formatServerTiming formats the timings as the value of the Server-Timing header.
+func formatServerTiming(timings []xray.Timing) string {
+	var buf strings.Builder
+	for i, t := range timings {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(serverTimingName(t.Name))
+		buf.WriteString(";dur=")
+		buf.WriteString(strconv.FormatFloat(float64(t.Duration)/float64(time.Millisecond), 'f', 3, 64))
+	}
+	return buf.String()
+}
+
+// serverTimingName converts the name of the subsegment into a token of the Server-Timing header.
+// The characters that are not allowed in tokens are replaced with "_".
+func serverTimingName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if isTokenChar(r) {
+			return r
+		}
+		return '_'
+	}, name)
+	if name == "" {
+		return "_"
+	}
+	return name
+}
+
+// isTokenChar reports whether r is allowed in tokens of RFC 9110.
+func isTokenChar(r rune) bool {
+	if 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' {
+		return true
+	}
+	return strings.ContainsRune("!#$%&'*+-.^_`|~", r)
+}
+
+// captureHeaders returns the values of the headers in names.
+// It returns nil if no header is found.
+func captureHeaders(header http.Header, names []string) map[string]string {
+	var ret map[string]string
+	for _, name := range names {
+		values := header[name]
+		if len(values) == 0 {
+			continue
+		}
+		if ret == nil {
+			ret = make(map[string]string, len(names))
+		}
+		ret[name] = strings.Join(values, ", ")
+	}
+	return ret
+}
+
+// redactQuery replaces the values of the redacted parameters in the query.
+// The order of the parameters is preserved.
+func redactQuery(rawQuery string, redactedParams map[string]struct{}) string {
+	if len(redactedParams) == 0 {
+		return rawQuery
+	}
+	params := strings.Split(rawQuery, "&")
+	for i, param := range params {
+		key, _, _ := strings.Cut(param, "=")
+		name, err := url.QueryUnescape(key)
+		if err != nil {
+			name = key
+		}
+		if _, ok := redactedParams[name]; ok {
+			params[i] = key + "=" + redacted
+		}
+	}
+	return strings.Join(params, "&")
+}
@@ -0,0 +1,410 @@
+package xrayhttp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/shogo82148/aws-xray-yasdk-go/xray"
+	"github.com/shogo82148/aws-xray-yasdk-go/xray/schema"
+)
+
+func TestHandlerWithOptions(t *testing.T) {
+	ctx, td := xray.NewTestDaemon(nil)
+	defer td.Close()
+
+	h := HandlerWithOptions(
+		FixedTracingNamer("test"),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("X-Secret", "secret")
+			w.Write([]byte("hello"))
+		}),
+		WithRequestHeaders("x-tenant-id", "Accept"),
+		WithResponseHeaders("content-type"),
+		WithQueryString("token", "api key"),
+		WithHeaderAnnotation("tenant", "X-Tenant-Id"),
+		WithAnnotations(func(r *http.Request) map[string]any {
+			return map[string]any{"api_key_id": r.URL.Query().Get("key_id")}
+		}),
+	)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/users?key_id=42&token=secret&api+key=secret&page=2", nil)
+	req.Header.Set("X-Tenant-Id", "example")
+	req.Header.Set("Authorization", "Bearer secret")
+	req = req.WithContext(ctx)
+	h.ServeHTTP(rec, req)
+
+	got, err := td.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "http://example.com/users?key_id=42&token=REDACTED&api+key=REDACTED&page=2"; got.HTTP.Request.URL != want {
+		t.Errorf("want %q, got %q", want, got.HTTP.Request.URL)
+	}
+	wantAnnotations := map[string]any{
+		"tenant":     "example",
+		"api_key_id": "42",
+	}
+	if diff := cmp.Diff(wantAnnotations, got.Annotations); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	wantMetadata := map[string]any{
+		"request_headers": map[string]any{
+			"X-Tenant-Id": "example",
+		},
+		"response_headers": map[string]any{
+			"Content-Type": "text/plain",
+		},
+	}
+	if diff := cmp.Diff(wantMetadata, got.Metadata["http"]); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestHandlerWithOptions_SkipPaths(t *testing.T) {
+	ctx, td := xray.NewTestDaemon(nil)
+	defer td.Close()
+	td.ContextMissing = func(ctx context.Context, v any) {
+		t.Errorf("unexpected context missing: %v", v)
+	}
+
+	var called bool
+	h := HandlerWithOptions(
+		FixedTracingNamer("test"),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/users" {
+				w.Write([]byte("ok"))
+				return
+			}
+			called = true
+			if seg := xray.ContextSegment(r.Context()); seg != nil {
+				t.Error("want not traced, but traced")
+			}
+			// the subsegments are ignored without the context missing errors.
+			_, seg := xray.BeginSubsegment(r.Context(), "database")
+			seg.Close()
+			w.Write([]byte("ok"))
+		}),
+		WithSkipPaths("/healthz", "/internal/*"),
+	)
+
+	for _, path := range []string{"/healthz", "/internal/metrics"} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "http://example.com"+path, nil)
+		req = req.WithContext(ctx)
+		h.ServeHTTP(rec, req)
+	}
+	if !called {
+		t.Error("the handler is not called")
+	}
+
+	// the other paths are traced.
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/users", nil)
+	req = req.WithContext(ctx)
+	h.ServeHTTP(rec, req)
+
+	got, err := td.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.HTTP.Request.URL != "http://example.com/users" {
+		t.Errorf("unexpected URL: %s", got.HTTP.Request.URL)
+	}
+}
+
+func TestRedactQuery(t *testing.T) {
+	redacted := map[string]struct{}{"token": {}}
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"token=secret", "token=REDACTED"},
+		{"a=1&token=secret&b", "a=1&token=REDACTED&b"},
+		{"token", "token=REDACTED"},
+		{"to%6Ben=secret", "to%6Ben=REDACTED"},
+	}
+	for _, tt := range tests {
+		if got := redactQuery(tt.query, redacted); got != tt.want {
+			t.Errorf("%q: want %q, got %q", tt.query, tt.want, got)
+		}
+	}
+}
+
+func TestHandlerWithOptions_ResponseHeaders(t *testing.T) {
+	ctx, td := xray.NewTestDaemon(nil)
+	defer td.Close()
+
+	h := HandlerWithOptions(
+		FixedTracingNamer("test"),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, seg := xray.BeginSubsegment(r.Context(), "db query")
+			seg.Close()
+			w.Write([]byte("hello"))
+		}),
+		WithTraceIDResponseHeader(),
+		WithServerTiming(),
+	)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	req = req.WithContext(ctx)
+	h.ServeHTTP(rec, req)
+
+	got, err := td.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := rec.Result()
+	header := xray.ParseTraceHeader(res.Header.Get(xray.TraceIDHeaderKey))
+	if header.TraceID != got.TraceID {
+		t.Errorf("want %q, got %q", got.TraceID, header.TraceID)
+	}
+	if header.SamplingDecision != xray.SamplingDecisionSampled {
+		t.Errorf("want %q, got %q", xray.SamplingDecisionSampled, header.SamplingDecision)
+	}
+
+	timing := res.Header.Get("Server-Timing")
+	if !regexp.MustCompile(`^db_query;dur=[0-9]+\.[0-9]{3}, total;dur=[0-9]+\.[0-9]{3}$`).MatchString(timing) {
+		t.Errorf("unexpected Server-Timing: %q", timing)
+	}
+}
+
+func TestHandlerWithOptions_TraceIDResponseHeader_NotSampled(t *testing.T) {
+	ctx, td := xray.NewTestDaemon(nil)
+	defer td.Close()
+
+	h := HandlerWithOptions(
+		FixedTracingNamer("test"),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}),
+		WithTraceIDResponseHeader(),
+	)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	req.Header.Set(xray.TraceIDHeaderKey, "Root=1-5e645f3e-1dfad076a177c5ccc5de12f5;Parent=03babb4ba280be51;Sampled=0")
+	req = req.WithContext(ctx)
+	h.ServeHTTP(rec, req)
+
+	res := rec.Result()
+	if want, got := "Root=1-5e645f3e-1dfad076a177c5ccc5de12f5;Sampled=0", res.Header.Get(xray.TraceIDHeaderKey); got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	if got := res.Header.Get("Server-Timing"); got != "" {
+		t.Errorf("want no Server-Timing, got %q", got)
+	}
+}
+
+func TestFormatServerTiming(t *testing.T) {
+	got := formatServerTiming([]xray.Timing{
+		{Name: "GET /users/:id", Duration: 1500 * time.Microsecond},
+		{Name: "", Duration: 0},
+		{Name: "total", Duration: 12345678 * time.Nanosecond},
+	})
+	want := "GET__users__id;dur=1.500, _;dur=0.000, total;dur=12.346"
+	if got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func TestHandlerWithOptions_RequestBody(t *testing.T) {
+	ctx, td := xray.NewTestDaemon(nil)
+	defer td.Close()
+
+	h := HandlerWithOptions(
+		FixedTracingNamer("test"),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, err := io.Copy(io.Discard, r.Body); err != nil {
+				t.Error(err)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}),
+		WithRequestBody(),
+	)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "http://example.com/upload", strings.NewReader("hello"))
+	req = req.WithContext(ctx)
+	h.ServeHTTP(rec, req)
+
+	got, err := td.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Error {
+		t.Error("want no error, but it has")
+	}
+	if len(got.Subsegments) != 2 {
+		t.Fatalf("want %d subsegments, got %d", 2, len(got.Subsegments))
+	}
+	body := got.Subsegments[0]
+	if body.Name != "request" {
+		t.Errorf("want %q, got %q", "request", body.Name)
+	}
+	if diff := cmp.Diff(float64(5), httpMetadata(body)["bytes_read"]); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	if _, ok := httpMetadata(body)["read_duration"].(float64); !ok {
+		t.Errorf("want read_duration, got %v", httpMetadata(body))
+	}
+}
+
+type abortedReader struct {
+	data []byte
+}
+
+func (r *abortedReader) Read(b []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	n := copy(b, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestHandlerWithOptions_RequestBody_Aborted(t *testing.T) {
+	ctx, td := xray.NewTestDaemon(nil)
+	defer td.Close()
+
+	h := HandlerWithOptions(
+		FixedTracingNamer("test"),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, err := io.ReadAll(r.Body); err == nil {
+				t.Error("want error, got nil")
+			}
+		}),
+		WithRequestBody(),
+	)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "http://example.com/upload", &abortedReader{data: []byte("hel")})
+	req = req.WithContext(ctx)
+	h.ServeHTTP(rec, req)
+
+	got, err := td.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Error {
+		t.Error("want error, but not")
+	}
+	if len(got.Subsegments) != 1 {
+		t.Fatalf("want %d subsegments, got %d", 1, len(got.Subsegments))
+	}
+	body := got.Subsegments[0]
+	if !body.Error {
+		t.Error("want error, but not")
+	}
+	want := map[string]any{
+		"bytes_read":    float64(3),
+		"read_duration": httpMetadata(body)["read_duration"],
+		"error":         io.ErrUnexpectedEOF.Error(),
+	}
+	if diff := cmp.Diff(want, httpMetadata(body)); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestHandlerWithOptions_FlushTiming(t *testing.T) {
+	ctx, td := xray.NewTestDaemon(nil)
+	defer td.Close()
+
+	h := HandlerWithOptions(
+		FixedTracingNamer("test"),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, "data: 1\n\n")
+			w.(http.Flusher).Flush()
+			io.WriteString(w, "data: 22\n\n")
+			w.(http.Flusher).Flush()
+		}),
+		WithFlushTiming(),
+	)
+
+	rec := httptest.NewRecorder()
+	rw := &dummyFlusher{
+		ResponseWriter: rec,
+	}
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/events", nil)
+	req = req.WithContext(ctx)
+	h.ServeHTTP(rw, req)
+
+	got, err := td.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Subsegments) != 1 {
+		t.Fatalf("want %d subsegments, got %d", 1, len(got.Subsegments))
+	}
+	metadata := httpMetadata(got.Subsegments[0])
+	if diff := cmp.Diff(float64(2), metadata["flush_count"]); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	flushes, ok := metadata["flushes"].([]any)
+	if !ok || len(flushes) != 2 {
+		t.Fatalf("want 2 flushes, got %v", metadata["flushes"])
+	}
+	for i, want := range []float64{9, 10} {
+		flush := flushes[i].(map[string]any)
+		if flush["bytes"] != want {
+			t.Errorf("flush %d: want %v bytes, got %v", i, want, flush["bytes"])
+		}
+	}
+	if !rw.called {
+		t.Error("Flush is not called")
+	}
+}
+
+// httpMetadata returns the metadata in the "http" namespace.
+func httpMetadata(seg *schema.Segment) map[string]any {
+	m, _ := seg.Metadata["http"].(map[string]any)
+	return m
+}
+
+func TestHandlerWithOptions_ResponseHeaders_NoWrite(t *testing.T) {
+	ctx, td := xray.NewTestDaemon(nil)
+	defer td.Close()
+
+	h := HandlerWithOptions(
+		FixedTracingNamer("test"),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// write nothing, and net/http responds 200 OK.
+		}),
+		WithClient(xray.ContextClient(ctx)),
+		WithTraceIDResponseHeader(),
+		WithServerTiming(),
+	)
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	got, err := td.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("want %d, got %d", http.StatusOK, res.StatusCode)
+	}
+	if header := xray.ParseTraceHeader(res.Header.Get(xray.TraceIDHeaderKey)); header.TraceID != got.TraceID {
+		t.Errorf("want %q, got %q", got.TraceID, header.TraceID)
+	}
+	if timing := res.Header.Get("Server-Timing"); !strings.HasPrefix(timing, "total;dur=") {
+		t.Errorf("unexpected Server-Timing: %q", timing)
+	}
+}
@@ -15,6 +15,7 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/shogo82148/aws-xray-yasdk-go/xray"
+	"github.com/shogo82148/aws-xray-yasdk-go/xray/sampling"
 	"github.com/shogo82148/aws-xray-yasdk-go/xray/schema"
 )
 
@@ -762,3 +763,117 @@ func TestResponseController(t *testing.T) {
 		t.Error("SetReadDeadline() is not called")
 	}
 }
+
+func TestHandler_SamplingRequested(t *testing.T) {
+	ctx, td := xray.NewTestDaemon(nil)
+	defer td.Close()
+
+	h := Handler(FixedTracingNamer("test"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+	req.Header.Set(xray.TraceIDHeaderKey, "Root=1-5e645f3e-1dfad076a177c5ccc5de12f5;Sampled=?")
+	req = req.WithContext(ctx)
+	h.ServeHTTP(rec, req)
+
+	want := "Root=1-5e645f3e-1dfad076a177c5ccc5de12f5;Sampled=1"
+	if got := rec.Header().Get(xray.TraceIDHeaderKey); got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	if _, err := td.Recv(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandler_Route(t *testing.T) {
+	ctx, td := xray.NewTestDaemon(nil)
+	defer td.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello " + r.PathValue("id")))
+	})
+	h := Handler(FixedTracingNamer("test"), mux)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/users/123", nil)
+	req = req.WithContext(ctx)
+	h.ServeHTTP(rec, req)
+
+	got, err := td.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"http_route": "GET /users/{id}"}
+	if diff := cmp.Diff(want, got.Annotations); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	if rec.Body.String() != "hello 123" {
+		t.Errorf("want %q, got %q", "hello 123", rec.Body.String())
+	}
+}
+
+func TestHandlerWithOptions_Route(t *testing.T) {
+	ctx, td := xray.NewTestDaemon(nil)
+	defer td.Close()
+
+	var url string
+	if err := xray.ContextClient(ctx).Reconfigure(&xray.Config{
+		DaemonAddress: td.DaemonAddress(),
+		SamplingStrategy: sampling.StrategyFunc(func(req *sampling.Request) *sampling.Decision {
+			url = req.URL
+			return &sampling.Decision{Sample: true}
+		}),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	})
+	h := HandlerWithOptions(FixedTracingNamer("test"), mux, WithRouteSampling(), WithRouteSubsegment())
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/users/123", nil)
+	req = req.WithContext(ctx)
+	h.ServeHTTP(rec, req)
+
+	got, err := td.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "/users/{id}" {
+		t.Errorf("want %q, got %q", "/users/{id}", url)
+	}
+	want := map[string]any{"http_route": "GET /users/{id}"}
+	if diff := cmp.Diff(want, got.Annotations); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	var names []string
+	for _, sub := range got.Subsegments {
+		names = append(names, sub.Name)
+	}
+	if diff := cmp.Diff([]string{"GET /users/:id", "response"}, names); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRoutePath(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{"/users/{id}", "/users/{id}"},
+		{"GET /users/{id}", "/users/{id}"},
+		{"GET example.com/users/{id}", "/users/{id}"},
+		{"example.com/", "/"},
+	}
+	for _, tt := range tests {
+		if got := routePath(tt.pattern); got != tt.want {
+			t.Errorf("%q: want %q, got %q", tt.pattern, tt.want, got)
+		}
+	}
+}
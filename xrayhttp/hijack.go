@@ -0,0 +1,377 @@
+package xrayhttp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/shogo82148/aws-xray-yasdk-go/xray"
+)
+
+// maxFrameEvents is the maximum number of the WebSocket frames that are recorded.
+const maxFrameEvents = 100
+
+// the close reasons of the hijacked connections.
+const (
+	closedByServer = "closed by server"
+	closedByClient = "closed by client"
+)
+
+// frameEvent is a WebSocket frame sent or received on the hijacked connection.
+type frameEvent struct {
+	// Offset is the time in seconds from the beginning of the connection.
+	Offset float64 `json:"offset"`
+
+	// Direction is "in" for the received frames, and "out" for the sent frames.
+	Direction string `json:"direction"`
+
+	// Opcode is the type of the frame, e.g. "text", "binary", "close".
+	Opcode string `json:"opcode"`
+
+	// Length is the length of the payload.
+	Length uint64 `json:"length"`
+}
+
+// connTracer traces the hijacked connection.
+// It keeps the "connection" subsegment open until the connection is closed.
+type connTracer struct {
+	net.Conn
+
+	mu       sync.Mutex
+	ctx      context.Context
+	seg      *xray.Segment
+	start    time.Time
+	bytesIn  int64
+	bytesOut int64
+
+	// the WebSocket frames. they are recorded if recordFrames is true.
+	recordFrames bool
+	in, out      *frameParser
+	frames       []frameEvent
+	framesIn     int
+	framesOut    int
+	closeCode    int
+}
+
+// traceConn begins the "connection" subsegment and wraps the hijacked connection.
+// The bytes buffered in buf are also counted as received or sent.
+func traceConn(ctx context.Context, conn net.Conn, buf *bufio.ReadWriter, recordFrames bool) (net.Conn, *bufio.ReadWriter) {
+	c := &connTracer{
+		Conn:         conn,
+		start:        time.Now(),
+		recordFrames: recordFrames,
+	}
+	c.ctx, c.seg = xray.BeginSubsegment(ctx, "connection")
+	if recordFrames {
+		c.in = &frameParser{onFrame: c.frameFunc("in")}
+		c.out = &frameParser{onFrame: c.frameFunc("out"), skipHTTPHead: true}
+		c.in.onClose = c.setCloseCode
+		c.out.onClose = c.setCloseCode
+	}
+
+	if buf == nil {
+		return c, buf
+	}
+	// the data that the server has already read from the client.
+	if n := buf.Reader.Buffered(); n > 0 {
+		peeked, _ := buf.Reader.Peek(n)
+		peeked = bytes.Clone(peeked)
+		c.received(peeked)
+		buf.Reader.Reset(io.MultiReader(bytes.NewReader(peeked), c))
+	} else {
+		buf.Reader.Reset(c)
+	}
+	// the data that the server has written but not flushed yet.
+	if n := buf.Writer.Buffered(); n > 0 {
+		if err := buf.Writer.Flush(); err != nil {
+			// keep the writer as is, to report the error to the handler.
+			return c, buf
+		}
+		c.mu.Lock()
+		c.bytesOut += int64(n)
+		c.mu.Unlock()
+	}
+	buf.Writer.Reset(c)
+	return c, buf
+}
+
+// Read implements [net.Conn].
+func (c *connTracer) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.received(b[:n])
+	if err != nil {
+		if err == io.EOF {
+			c.finish(closedByClient, nil)
+		} else if !isTimeout(err) {
+			c.finish("", err)
+		}
+	}
+	return n, err
+}
+
+// Write implements [net.Conn].
+func (c *connTracer) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.mu.Lock()
+	c.bytesOut += int64(n)
+	if c.out != nil {
+		c.out.feed(b[:n])
+	}
+	c.mu.Unlock()
+	if err != nil && !isTimeout(err) {
+		c.finish("", err)
+	}
+	return n, err
+}
+
+// Close implements [net.Conn].
+func (c *connTracer) Close() error {
+	err := c.Conn.Close()
+	c.finish(closedByServer, nil)
+	return err
+}
+
+// received counts the data received from the client.
+func (c *connTracer) received(b []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.bytesIn += int64(len(b))
+	if c.in != nil {
+		c.in.feed(b)
+	}
+}
+
+func (c *connTracer) frameFunc(direction string) func(opcode byte, length uint64) {
+	// c.mu is locked while the parsers run.
+	return func(opcode byte, length uint64) {
+		if direction == "in" {
+			c.framesIn++
+		} else {
+			c.framesOut++
+		}
+		if len(c.frames) < maxFrameEvents {
+			c.frames = append(c.frames, frameEvent{
+				Offset:    time.Since(c.start).Seconds(),
+				Direction: direction,
+				Opcode:    opcodeName(opcode),
+				Length:    length,
+			})
+		}
+	}
+}
+
+func (c *connTracer) setCloseCode(code int) {
+	// c.mu is locked while the parsers run.
+	if c.closeCode == 0 {
+		c.closeCode = code
+	}
+}
+
+// finish closes the subsegment.
+// The reason is the error message if err is not nil.
+func (c *connTracer) finish(reason string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ctx == nil {
+		return
+	}
+	if err != nil {
+		if errors.Is(err, net.ErrClosed) {
+			// the connection is being closed by the server.
+			return
+		}
+		reason = err.Error()
+		c.seg.SetError()
+	}
+	c.seg.AddMetadataToNamespace(metadataNamespace, "bytes_in", c.bytesIn)
+	c.seg.AddMetadataToNamespace(metadataNamespace, "bytes_out", c.bytesOut)
+	c.seg.AddMetadataToNamespace(metadataNamespace, "close_reason", reason)
+	if c.recordFrames {
+		c.seg.AddMetadataToNamespace(metadataNamespace, "frames_in", c.framesIn)
+		c.seg.AddMetadataToNamespace(metadataNamespace, "frames_out", c.framesOut)
+		if c.frames != nil {
+			c.seg.AddMetadataToNamespace(metadataNamespace, "frames", c.frames)
+		}
+		if c.closeCode != 0 {
+			c.seg.AddMetadataToNamespace(metadataNamespace, "close_code", c.closeCode)
+		}
+	}
+	c.seg.Close()
+	c.ctx, c.seg = nil, nil
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// frameParser parses the stream of the WebSocket frames defined in RFC 6455.
+type frameParser struct {
+	header    []byte
+	inPayload bool
+	opcode    byte
+	masked    bool
+	maskKey   [4]byte
+	remaining uint64
+	pos       uint64
+	closeCode []byte
+
+	// skipHTTPHead skips the HTTP response head at the beginning of the stream,
+	// e.g. "HTTP/1.1 101 Switching Protocols\r\n...\r\n\r\n" that the handler writes after hijacking.
+	skipHTTPHead bool
+	headStarted  bool
+	headCRLF     int
+
+	// onFrame is called when the header of a frame is parsed.
+	onFrame func(opcode byte, length uint64)
+
+	// onClose is called with the status code of the close frame.
+	onClose func(code int)
+}
+
+func (p *frameParser) feed(b []byte) {
+	for len(b) > 0 && p.skipHTTPHead {
+		if !p.headStarted {
+			if b[0] != 'H' {
+				// the handler has written the response head before hijacking.
+				p.skipHTTPHead = false
+				break
+			}
+			p.headStarted = true
+		}
+		switch {
+		case b[0] == "\r\n\r\n"[p.headCRLF]:
+			p.headCRLF++
+			if p.headCRLF == 4 {
+				p.skipHTTPHead = false
+			}
+		case b[0] == '\r':
+			p.headCRLF = 1
+		default:
+			p.headCRLF = 0
+		}
+		b = b[1:]
+	}
+
+	for len(b) > 0 {
+		if p.inPayload {
+			n := min(uint64(len(b)), p.remaining)
+			if p.opcode == opClose {
+				for i := uint64(0); i < n && len(p.closeCode) < 2; i++ {
+					v := b[i]
+					if p.masked {
+						v ^= p.maskKey[(p.pos+i)%4]
+					}
+					p.closeCode = append(p.closeCode, v)
+				}
+			}
+			p.pos += n
+			p.remaining -= n
+			b = b[n:]
+			if p.remaining == 0 {
+				p.endFrame()
+			}
+			continue
+		}
+
+		n := min(frameHeaderSize(p.header)-len(p.header), len(b))
+		p.header = append(p.header, b[:n]...)
+		b = b[n:]
+		if len(p.header) < 2 || len(p.header) < frameHeaderSize(p.header) {
+			continue
+		}
+		p.parseHeader()
+	}
+}
+
+func (p *frameParser) parseHeader() {
+	h := p.header
+	p.opcode = h[0] & 0x0f
+	p.masked = h[1]&0x80 != 0
+	length := uint64(h[1] & 0x7f)
+	i := 2
+	switch length {
+	case 126:
+		length = uint64(h[2])<<8 | uint64(h[3])
+		i += 2
+	case 127:
+		length = 0
+		for _, v := range h[2:10] {
+			length = length<<8 | uint64(v)
+		}
+		i += 8
+	}
+	if p.masked {
+		copy(p.maskKey[:], h[i:i+4])
+	}
+	if p.onFrame != nil {
+		p.onFrame(p.opcode, length)
+	}
+	p.remaining = length
+	p.pos = 0
+	p.inPayload = length > 0
+	if !p.inPayload {
+		p.endFrame()
+	}
+}
+
+func (p *frameParser) endFrame() {
+	if p.opcode == opClose && len(p.closeCode) == 2 && p.onClose != nil {
+		p.onClose(int(p.closeCode[0])<<8 | int(p.closeCode[1]))
+	}
+	p.header = p.header[:0]
+	p.inPayload = false
+	p.closeCode = p.closeCode[:0]
+}
+
+// frameHeaderSize returns the size of the frame header that begins with h.
+func frameHeaderSize(h []byte) int {
+	if len(h) < 2 {
+		return 2
+	}
+	size := 2
+	switch h[1] & 0x7f {
+	case 126:
+		size += 2
+	case 127:
+		size += 8
+	}
+	if h[1]&0x80 != 0 {
+		size += 4
+	}
+	return size
+}
+
+// the opcodes of the WebSocket frames.
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+func opcodeName(opcode byte) string {
+	switch opcode {
+	case opContinuation:
+		return "continuation"
+	case opText:
+		return "text"
+	case opBinary:
+		return "binary"
+	case opClose:
+		return "close"
+	case opPing:
+		return "ping"
+	case opPong:
+		return "pong"
+	}
+	return fmt.Sprintf("0x%x", opcode)
+}
@@ -0,0 +1,196 @@
+package xrayhttp
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/shogo82148/aws-xray-yasdk-go/xray"
+)
+
+func TestFrameParser(t *testing.T) {
+	type frame struct {
+		Opcode string
+		Length uint64
+	}
+	var frames []frame
+	var closeCode int
+	p := &frameParser{
+		onFrame: func(opcode byte, length uint64) {
+			frames = append(frames, frame{opcodeName(opcode), length})
+		},
+		onClose: func(code int) {
+			closeCode = code
+		},
+	}
+
+	var stream []byte
+	// unmasked text frame "hello"
+	stream = append(stream, 0x81, 0x05, 'h', 'e', 'l', 'l', 'o')
+	// masked binary frame with 16-bit length
+	stream = append(stream, 0x82, 0x80|126, 0x01, 0x00, 0x01, 0x02, 0x03, 0x04)
+	stream = append(stream, make([]byte, 256)...)
+	// ping frame without payload
+	stream = append(stream, 0x89, 0x00)
+	// masked close frame with status code 1001
+	mask := [4]byte{0x11, 0x22, 0x33, 0x44}
+	stream = append(stream, 0x88, 0x82, mask[0], mask[1], mask[2], mask[3], 0x03^mask[0], 0xe9^mask[1])
+
+	// feed the stream byte by byte, to check the frames split across the reads.
+	for i := range stream {
+		p.feed(stream[i : i+1])
+	}
+
+	want := []frame{
+		{"text", 5},
+		{"binary", 256},
+		{"ping", 0},
+		{"close", 2},
+	}
+	if diff := cmp.Diff(want, frames); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	if closeCode != 1001 {
+		t.Errorf("want %d, got %d", 1001, closeCode)
+	}
+}
+
+func TestHandlerWithOptions_WebSocketFrames(t *testing.T) {
+	ctx, td := xray.NewTestDaemon(nil)
+	defer td.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			panic(err)
+		}
+		defer conn.Close()
+
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		buf.Write([]byte{0x81, 0x05, 'h', 'e', 'l', 'l', 'o'})
+		if err := buf.Flush(); err != nil {
+			panic(err)
+		}
+
+		// wait for the close frame from the client.
+		var frame [8]byte
+		if _, err := io.ReadFull(buf, frame[:]); err != nil {
+			panic(err)
+		}
+	})
+	h := HandlerWithOptions(
+		FixedTracingNamer("test"),
+		mux,
+		WithClient(xray.ContextClient(ctx)),
+		WithWebSocketFrames(),
+	)
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(ts.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := io.WriteString(conn, "GET /ws HTTP/1.1\r\nHost: example.com\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("want %d, got %d", http.StatusSwitchingProtocols, resp.StatusCode)
+	}
+	var frame [7]byte
+	if _, err := io.ReadFull(br, frame[:]); err != nil {
+		t.Fatal(err)
+	}
+	// the masked close frame with status code 1000.
+	if _, err := conn.Write([]byte{0x88, 0x82, 0, 0, 0, 0, 0x03, 0xe8}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(br); err != nil {
+		t.Fatal(err)
+	}
+
+	// the segment is emitted when the connection is hijacked.
+	got, err := td.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.HTTP.Response.Status != http.StatusSwitchingProtocols {
+		t.Errorf("want %d, got %d", http.StatusSwitchingProtocols, got.HTTP.Response.Status)
+	}
+	if route := got.Annotations["http_route"]; route != "GET /ws" {
+		t.Errorf("want %q, got %v", "GET /ws", route)
+	}
+	if len(got.Subsegments) != 1 || !got.Subsegments[0].InProgress {
+		t.Fatalf("want the connection in progress, got %v", got.Subsegments)
+	}
+
+	// the subsegment is emitted when the connection is closed.
+	sub, err := td.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.Name != "connection" {
+		t.Errorf("want %q, got %q", "connection", sub.Name)
+	}
+	if sub.ParentID != got.ID {
+		t.Errorf("want %q, got %q", got.ID, sub.ParentID)
+	}
+	metadata := httpMetadata(sub)
+	want := map[string]any{
+		"bytes_in":     float64(8),
+		"bytes_out":    float64(len("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n") + 7),
+		"close_reason": closedByServer,
+		"frames_in":    float64(1),
+		"frames_out":   float64(1),
+		"close_code":   float64(1000),
+		"frames": []any{
+			map[string]any{"offset": metadata["frames"].([]any)[0].(map[string]any)["offset"], "direction": "out", "opcode": "text", "length": float64(5)},
+			map[string]any{"offset": metadata["frames"].([]any)[1].(map[string]any)["offset"], "direction": "in", "opcode": "close", "length": float64(2)},
+		},
+	}
+	if diff := cmp.Diff(want, metadata); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestTraceConn_BufferedWriter(t *testing.T) {
+	ctx, td := xray.NewTestDaemon(nil)
+	defer td.Close()
+
+	ctx, root := xray.BeginSegment(ctx, "test")
+	server, client := net.Pipe()
+	defer client.Close()
+	go io.Copy(io.Discard, client)
+
+	// the server has written the data, but not flushed it yet.
+	buf := bufio.NewReadWriter(bufio.NewReader(server), bufio.NewWriter(server))
+	buf.WriteString("hello")
+	conn, buf := traceConn(ctx, server, buf, false)
+	buf.WriteString("world")
+	if err := buf.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	root.Close()
+
+	got, err := td.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata := httpMetadata(got.Subsegments[0])
+	if out := metadata["bytes_out"]; out != float64(len("helloworld")) {
+		t.Errorf("want %d, got %v", len("helloworld"), out)
+	}
+}